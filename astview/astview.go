@@ -18,6 +18,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/visualfc/gotools/pkg/buildctx"
 	"github.com/visualfc/gotools/pkg/command"
 	"github.com/visualfc/gotools/pkg/pkgutil"
 )
@@ -36,6 +37,7 @@ var (
 	astViewOutline        bool
 	astViewShowTypeParams bool
 	astViewSep            string
+	astViewOverlay        string
 )
 
 func init() {
@@ -45,6 +47,7 @@ func init() {
 	Command.Flag.BoolVar(&astViewShowTypeParams, "tp", false, "show typeparams")
 	Command.Flag.BoolVar(&astViewOutline, "outline", false, "set outline mode")
 	Command.Flag.StringVar(&astViewSep, "sep", ",", "set output seperator")
+	Command.Flag.StringVar(&astViewOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
 }
 
 func runAstView(cmd *command.Command, args []string) error {
@@ -52,7 +55,30 @@ func runAstView(cmd *command.Command, args []string) error {
 		cmd.Usage()
 		return os.ErrInvalid
 	}
-	if astViewStdin {
+	if cmd.JSON() {
+		astViewOutput = func(item *Item) {
+			cmd.PrintResult(item, "")
+		}
+		defer func() {
+			astViewOutput = nil
+		}()
+	}
+	if astViewOverlay != "" {
+		if astViewOverlay == "-" && astViewStdin {
+			return fmt.Errorf("-overlay - and -stdin both read stdin")
+		}
+		if _, err := buildctx.LoadOverlay(astViewOverlay, cmd.Stdin); err != nil {
+			return err
+		}
+		defer buildctx.SetOverlay(nil)
+	}
+	if astViewStdin && astViewOutline {
+		src, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		return PrintFileOutlineSource(args[0], src, cmd.Stdout, astViewSep, true)
+	} else if astViewStdin {
 		view, err := NewFilePackageSource(args[0], cmd.Stdin, true)
 		if err != nil {
 			return err
@@ -95,6 +121,42 @@ const (
 	tag_todo_folder    = "+b"
 )
 
+// Item is the json output of one astview line "level,tag,name,pos@info".
+type Item struct {
+	Level     int    `json:"level"`
+	Tag       string `json:"tag"`
+	Name      string `json:"name"`
+	Filename  string `json:"filename,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Info      string `json:"info,omitempty"`
+}
+
+// astViewOutput receives the items instead of the text output in json mode.
+var astViewOutput func(item *Item)
+
+func newItem(fset *token.FileSet, level int, node ast.Node, info string, text []string) *Item {
+	item := &Item{Level: level, Info: info}
+	if len(text) > 0 {
+		item.Tag = text[0]
+	}
+	if len(text) > 1 {
+		item.Name = text[1]
+	}
+	if len(text) > 2 && info == "" {
+		item.Info = strings.Join(text[2:], astViewSep)
+	}
+	if node != nil {
+		pos := fset.Position(node.Pos())
+		end := fset.Position(node.End())
+		item.Filename, item.Line, item.Column = pos.Filename, pos.Line, pos.Column
+		item.EndLine, item.EndColumn = end.Line, end.Column
+	}
+	return item
+}
+
 type PackageView struct {
 	fset *token.FileSet
 	pdoc *PackageDoc
@@ -132,7 +194,7 @@ func (p *PackageView) posText(node ast.Node) string {
 func NewFilePackage(filename string) (*PackageView, error) {
 	p := new(PackageView)
 	p.fset = token.NewFileSet()
-	file, err := parser.ParseFile(p.fset, filename, nil, parser.AllErrors)
+	file, err := parser.ParseFile(p.fset, filename, buildctx.FileSource(filename), parser.AllErrors)
 	if file == nil {
 		return nil, err
 	}
@@ -159,7 +221,7 @@ func NewPackageView(pkg *ast.Package, fset *token.FileSet, expr bool) (*PackageV
 func ParseFiles(fset *token.FileSet, filenames []string, mode parser.Mode) (pkgs map[string]*ast.Package, pkgsfiles []string, first error) {
 	pkgs = make(map[string]*ast.Package)
 	for _, filename := range filenames {
-		if src, err := parser.ParseFile(fset, filename, nil, mode); src != nil {
+		if src, err := parser.ParseFile(fset, filename, buildctx.FileSource(filename), mode); src != nil {
 			name := src.Name.Name
 			pkg, found := pkgs[name]
 			if !found {
@@ -191,7 +253,9 @@ func PrintFilesTree(filenames []string, w io.Writer, expr bool) error {
 	}
 	AllFiles = pkgsfiles
 	for i := 0; i < len(AllFiles); i++ {
-		fmt.Fprintf(w, "@%s\n", AllFiles[i])
+		if astViewOutput == nil {
+			fmt.Fprintf(w, "@%s\n", AllFiles[i])
+		}
 	}
 	for _, pkg := range pkgs {
 		view, err := NewPackageView(pkg, fset, expr)
@@ -231,15 +295,31 @@ func NewFilePackageSource(filename string, f io.Reader, expr bool) (*PackageView
 }
 
 func (p *PackageView) out0(w io.Writer, level int, text ...string) {
+	if astViewOutput != nil {
+		astViewOutput(newItem(p.fset, level, nil, "", text))
+		return
+	}
 	fmt.Fprintf(w, "%v%s%s\n", level, astViewSep, strings.Join(text, astViewSep))
 }
 func (p *PackageView) out1(w io.Writer, level int, pos ast.Node, text ...string) {
+	if astViewOutput != nil {
+		astViewOutput(newItem(p.fset, level, pos, "", text))
+		return
+	}
 	fmt.Fprintf(w, "%v%s%s%s%s\n", level, astViewSep, strings.Join(text, astViewSep), astViewSep, p.posText(pos))
 }
 func (p *PackageView) out2(w io.Writer, level int, pos ast.Node, expr ast.Expr, text ...string) {
+	if astViewOutput != nil {
+		astViewOutput(newItem(p.fset, level, pos, types.ExprString(expr), text))
+		return
+	}
 	fmt.Fprintf(w, "%v%s%s%s%s@%v\n", level, astViewSep, strings.Join(text, astViewSep), astViewSep, p.posText(pos), types.ExprString(expr))
 }
 func (p *PackageView) out2s(w io.Writer, level int, pos ast.Node, expr string, text ...string) {
+	if astViewOutput != nil {
+		astViewOutput(newItem(p.fset, level, pos, expr, text))
+		return
+	}
 	fmt.Fprintf(w, "%v%s%s%s%s@%v\n", level, astViewSep, strings.Join(text, astViewSep), astViewSep, p.posText(pos), expr)
 }
 
@@ -424,12 +504,18 @@ func (p *PackageView) PrintTree(w io.Writer) {
 
 // level,tag,pos@info
 func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) error {
+	return PrintFileOutlineSource(filename, buildctx.FileSource(filename), w, sep, showexpr)
+}
+
+// PrintFileOutlineSource is like PrintFileOutline, but parses src instead of
+// the file content if src != nil.
+func PrintFileOutlineSource(filename string, src interface{}, w io.Writer, sep string, showexpr bool) error {
 	fset := token.NewFileSet()
 	mode := parser.AllErrors
 	if astViewShowTodo {
 		mode |= parser.ParseComments
 	}
-	f, err := parser.ParseFile(fset, filename, nil, mode)
+	f, err := parser.ParseFile(fset, filename, src, mode)
 	if err != nil {
 		return err
 	}
@@ -443,19 +529,37 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 	}
 
 	out0 := func(level int, text ...string) {
+		if astViewOutput != nil {
+			astViewOutput(newItem(fset, level, nil, "", text))
+			return
+		}
 		fmt.Fprintf(w, "%v%s%s\n", level, sep, strings.Join(text, sep))
 	}
 	out1 := func(level int, pos ast.Node, text ...string) {
+		if astViewOutput != nil {
+			astViewOutput(newItem(fset, level, pos, "", text))
+			return
+		}
 		fmt.Fprintf(w, "%v%s%s%s%s\n", level, sep, strings.Join(text, sep), sep, posText(pos))
 	}
 	out2 := func(level int, pos ast.Node, expr ast.Expr, text ...string) {
+		if astViewOutput != nil {
+			astViewOutput(newItem(fset, level, pos, types.ExprString(expr), text))
+			return
+		}
 		fmt.Fprintf(w, "%v%s%s%s%s@%v\n", level, sep, strings.Join(text, sep), sep, posText(pos), types.ExprString(expr))
 	}
 	out2s := func(level int, pos ast.Node, expr string, text ...string) {
+		if astViewOutput != nil {
+			astViewOutput(newItem(fset, level, pos, expr, text))
+			return
+		}
 		fmt.Fprintf(w, "%v%s%s%s%s@%v\n", level, sep, strings.Join(text, sep), sep, posText(pos), expr)
 	}
 
-	fmt.Fprintf(w, "@%s\n", filename)
+	if astViewOutput == nil {
+		fmt.Fprintf(w, "@%s\n", filename)
+	}
 	level := 0
 	out1(level, f.Name, tag_package, f.Name.Name)
 	// level++
@@ -475,7 +579,50 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 	sort.Slice(f.Decls, func(i, j int) bool {
 		return f.Decls[i].Pos() < f.Decls[j].Pos()
 	})
-	for _, decl := range f.Decls {
+	walkOutline(f.Decls, level, astViewShowTypeParams, func(e *outlineEntry) {
+		if e.expr == nil {
+			out1(e.level, e.node, e.tag, e.name)
+		} else {
+			out2(e.level, e.node, e.expr, e.tag, e.name)
+		}
+	})
+
+	if astViewShowTodo {
+		var todoList []*TodoDoc
+		for _, c := range f.Comments {
+			text := c.List[0].Text
+			if m := todo_markers.FindStringSubmatchIndex(text); m != nil {
+				todoList = append(todoList, &TodoDoc{text[m[2]:m[3]], text[m[2]:], c})
+			}
+		}
+		if len(todoList) > 0 {
+			out0(level, tag_todo_folder, "TodoList")
+			level++
+			for _, todo := range todoList {
+				c := todo.Comments.List[0]
+				out2s(level, c, todo.Text, tag_todo, todo.Tag)
+			}
+			level--
+		}
+	}
+	return nil
+}
+
+// outlineEntry is one declaration of the file outline.
+type outlineEntry struct {
+	level int
+	node  ast.Node   // node of the position
+	ident *ast.Ident // declared name, nil for embedded interfaces
+	expr  ast.Expr   // type or value printed as info, may be nil
+	tag   string
+	name  string
+}
+
+// walkOutline calls out for the types, fields, interface methods, consts,
+// vars and funcs of decls in order. Fields and interface methods are one
+// level below their type.
+func walkOutline(decls []ast.Decl, level int, showTypeParams bool, out func(e *outlineEntry)) {
+	for _, decl := range decls {
 		switch d := decl.(type) {
 		case *ast.GenDecl:
 			switch d.Tok {
@@ -485,29 +632,29 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 					ts := spec.(*ast.TypeSpec)
 					switch t := ts.Type.(type) {
 					case *ast.StructType:
-						out2(level, ts, t, tag_struct, typeName(ts, astViewShowTypeParams))
+						out(&outlineEntry{level, ts, ts.Name, t, tag_struct, typeName(ts, showTypeParams)})
 						level++
 						for _, f := range t.Fields.List {
 							for _, name := range f.Names {
-								out2(level, f, f.Type, tag_type_value, name.String())
+								out(&outlineEntry{level, f, name, f.Type, tag_type_value, name.String()})
 							}
 						}
 						level--
 					case *ast.InterfaceType:
-						out2(level, ts, t, tag_interface, typeName(ts, astViewShowTypeParams))
+						out(&outlineEntry{level, ts, ts.Name, t, tag_interface, typeName(ts, showTypeParams)})
 						level++
 						for _, f := range t.Methods.List {
 							if len(f.Names) != 0 {
 								for _, name := range f.Names {
-									out2(level, f, f.Type, tag_type_method, name.String())
+									out(&outlineEntry{level, f, name, f.Type, tag_type_method, name.String()})
 								}
 							} else {
-								out2(level, f, f.Type, tag_type, types.ExprString(f.Type))
+								out(&outlineEntry{level, f, nil, f.Type, tag_type, types.ExprString(f.Type)})
 							}
 						}
 						level--
 					default:
-						out2(level, ts, t, tag_type, typeName(ts, astViewShowTypeParams))
+						out(&outlineEntry{level, ts, ts.Name, t, tag_type, typeName(ts, showTypeParams)})
 					}
 				}
 			case token.CONST:
@@ -515,9 +662,9 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 					vs := spec.(*ast.ValueSpec)
 					for i, name := range vs.Names {
 						if vs.Values == nil {
-							out1(level, vs, tag_const, name.String())
+							out(&outlineEntry{level, vs, name, nil, tag_const, name.String()})
 						} else {
-							out2(level, vs, vs.Values[i], tag_const, name.String())
+							out(&outlineEntry{level, vs, name, vs.Values[i], tag_const, name.String()})
 						}
 					}
 				}
@@ -526,9 +673,9 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 					vs := spec.(*ast.ValueSpec)
 					for _, name := range vs.Names {
 						if vs.Type == nil {
-							out1(level, vs, tag_value, name.String())
+							out(&outlineEntry{level, vs, name, nil, tag_value, name.String()})
 						} else {
-							out2(level, vs, vs.Type, tag_value, name.String())
+							out(&outlineEntry{level, vs, name, vs.Type, tag_value, name.String()})
 						}
 					}
 				}
@@ -536,7 +683,7 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 		case *ast.FuncDecl:
 			if d.Recv != nil {
 				var name string
-				if astViewShowTypeParams {
+				if showTypeParams {
 					name = types.ExprString(d.Recv.List[0].Type)
 				} else {
 					var star bool
@@ -545,30 +692,10 @@ func PrintFileOutline(filename string, w io.Writer, sep string, showexpr bool) e
 						name = "*" + name
 					}
 				}
-				out2(level, d, d.Type, tag_func, "("+name+")."+d.Name.String())
+				out(&outlineEntry{level, d, d.Name, d.Type, tag_func, "(" + name + ")." + d.Name.String()})
 			} else {
-				out2(level, d, d.Type, tag_func, funcName(d, astViewShowTypeParams))
+				out(&outlineEntry{level, d, d.Name, d.Type, tag_func, funcName(d, showTypeParams)})
 			}
 		}
 	}
-
-	if astViewShowTodo {
-		var todoList []*TodoDoc
-		for _, c := range f.Comments {
-			text := c.List[0].Text
-			if m := todo_markers.FindStringSubmatchIndex(text); m != nil {
-				todoList = append(todoList, &TodoDoc{text[m[2]:m[3]], text[m[2]:], c})
-			}
-		}
-		if len(todoList) > 0 {
-			out0(level, tag_todo_folder, "TodoList")
-			level++
-			for _, todo := range todoList {
-				c := todo.Comments.List[0]
-				out2s(level, c, todo.Text, tag_todo, todo.Tag)
-			}
-			level--
-		}
-	}
-	return nil
 }
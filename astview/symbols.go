@@ -0,0 +1,66 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astview
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Symbol is a declaration of a file outline.
+type Symbol struct {
+	Kind      string `json:"kind"` // type, struct, interface, func, method, field, const or var
+	Name      string `json:"name"` // Type.Method for methods
+	Container string `json:"container,omitempty"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+}
+
+// FileSymbols returns the symbols of the outline of f at the positions of
+// their names. Methods are named Type.Method, fields and methods have their
+// type as container.
+func FileSymbols(fset *token.FileSet, f *ast.File) (list []*Symbol) {
+	var container string
+	walkOutline(f.Decls, 0, false, func(e *outlineEntry) {
+		if e.ident == nil || e.ident.Name == "_" {
+			return
+		}
+		s := &Symbol{Name: e.ident.Name}
+		switch e.tag {
+		case tag_struct:
+			s.Kind = "struct"
+		case tag_interface:
+			s.Kind = "interface"
+		case tag_type:
+			s.Kind = "type"
+		case tag_const:
+			s.Kind = "const"
+		case tag_value:
+			s.Kind = "var"
+		case tag_type_value:
+			s.Kind = "field"
+			s.Container = container
+		case tag_type_method:
+			s.Kind = "method"
+			s.Container = container
+			s.Name = container + "." + s.Name
+		case tag_func:
+			s.Kind = "func"
+			if d := e.node.(*ast.FuncDecl); d.Recv != nil && len(d.Recv.List) > 0 {
+				recv, _ := recvTypeName(d.Recv.List[0].Type, true)
+				s.Kind = "method"
+				s.Container = recv
+				s.Name = recv + "." + s.Name
+			}
+		}
+		if e.level == 0 {
+			container = e.ident.Name
+		}
+		pos := fset.Position(e.ident.Pos())
+		s.Line, s.Column = pos.Line, pos.Column
+		list = append(list, s)
+	})
+	return
+}
@@ -0,0 +1,59 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/pkgcache"
+)
+
+var Command = &command.Command{
+	Run:       runCache,
+	UsageLine: "cache [-dir dir] clean|stats",
+	Short:     "manage the export data cache",
+	Long: `Cache manages the export data cache of type-checked dependency packages
+used by the types, check and finddoc commands. The cache is enabled by
+setting GOTOOLS_CACHE to a directory.
+
+	clean	remove all cache entries
+	stats	print the number of entries and their size`,
+}
+
+var cacheDir string
+
+func init() {
+	Command.Flag.StringVar(&cacheDir, "dir", "", "cache directory (default $GOTOOLS_CACHE)")
+}
+
+func runCache(cmd *command.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	c := pkgcache.Default()
+	if cacheDir != "" {
+		c = &pkgcache.Cache{Dir: cacheDir}
+	}
+	if c == nil {
+		return fmt.Errorf("cache disabled, set %v or -dir", pkgcache.EnvName)
+	}
+	switch args[0] {
+	case "clean":
+		return c.Clean()
+	case "stats":
+		s, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		cmd.PrintResult(s, s.String())
+		return nil
+	default:
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package check
+
+import (
+	"fmt"
+	"go/build"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/pkgutil"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runCheck,
+	UsageLine: "check [-tags tags] [-contexts goos-goarch[-cgo],...] [pkgs...]",
+	Short:     "type-check packages and print diagnostics",
+	Long: `Check parses and type-checks the packages, by default the package in the
+current directory, and prints every parse and type error, unused imports
+and unused variables as file:line:column: severity: message.
+
+The packages are directories, import paths or patterns ending in /... .
+With -contexts each package is checked for every GOOS/GOARCH context and
+diagnostics that do not appear in all contexts are followed by the
+contexts they appear in.`,
+}
+
+var (
+	checkTags     string
+	checkContexts string
+	checkTest     bool
+	checkPosEnc   string
+)
+
+func init() {
+	Command.Flag.StringVar(&checkTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.StringVar(&checkContexts, "contexts", "", "optional comma-separated list of <goos>-<goarch>[-cgo] to check instead of the default context")
+	Command.Flag.BoolVar(&checkTest, "test", true, "check test files")
+	Command.Flag.StringVar(&checkPosEnc, "posenc", "byte", "encoding of diagnostic columns: byte, rune or utf16")
+}
+
+// Result is a diagnostic and the contexts it was reported in.
+type Result struct {
+	*types.Diagnostic
+	Contexts []string `json:"contexts,omitempty"`
+}
+
+func runCheck(cmd *command.Command, args []string) error {
+	contexts, err := parseContexts(checkContexts)
+	if err != nil {
+		return err
+	}
+	enc, err := srcpos.ParseEncoding(checkPosEnc)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var pkgs []string
+	for _, arg := range args {
+		list, err := pkgutil.ExpandPattern(arg)
+		if err != nil {
+			return err
+		}
+		pkgs = append(pkgs, list...)
+	}
+
+	var results []*Result
+	index := make(map[string]*Result)
+	for _, context := range contexts {
+		name := contextName(context)
+		w := types.NewPkgWalker(context)
+		w.SetOutput(cmd.Stdout, cmd.Stderr)
+		w.PosEncoding = enc
+		for _, pkg := range pkgs {
+			var list []*types.Diagnostic
+			_, conf, err := w.Check(pkg, types.NewPkgConfig(false, checkTest), nil)
+			if conf == nil {
+				if _, ok := err.(*build.NoGoError); ok && len(contexts) > 1 {
+					continue
+				}
+				list = append(list, &types.Diagnostic{Filename: pkg, Severity: "error", Message: fmt.Sprint(err)})
+			} else {
+				list = w.Diagnostics(conf)
+			}
+			for _, d := range list {
+				key := d.String()
+				r, ok := index[key]
+				if !ok {
+					r = &Result{Diagnostic: d}
+					index[key] = r
+					results = append(results, r)
+				}
+				r.Contexts = append(r.Contexts, name)
+			}
+		}
+	}
+	for _, r := range results {
+		text := r.Diagnostic.String()
+		if len(r.Contexts) == len(contexts) {
+			r.Contexts = nil
+		} else {
+			text += " (" + strings.Join(r.Contexts, ", ") + ")"
+		}
+		cmd.PrintResult(r, text)
+	}
+	return nil
+}
+
+func contextName(c *build.Context) string {
+	s := c.GOOS + "-" + c.GOARCH
+	if c.CgoEnabled {
+		return s + "-cgo"
+	}
+	return s
+}
+
+// parseContexts returns the build contexts of the comma-separated list of
+// goos-goarch[-cgo], or the system context if list is empty.
+func parseContexts(list string) ([]*build.Context, error) {
+	var tags []string
+	if checkTags != "" {
+		tags = strings.Split(checkTags, " ")
+	}
+	if list == "" {
+		c := buildctx.System()
+		c.BuildTags = append(tags, c.BuildTags...)
+		return []*build.Context{c}, nil
+	}
+	var contexts []*build.Context
+	for _, s := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(s), "-")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "cgo") {
+			return nil, fmt.Errorf("bad context: %q", s)
+		}
+		c := buildctx.System()
+		c.GOOS, c.GOARCH = parts[0], parts[1]
+		c.CgoEnabled = len(parts) == 3
+		c.BuildTags = append(tags, c.BuildTags...)
+		setToolTags(c)
+		contexts = append(contexts, c)
+	}
+	return contexts, nil
+}
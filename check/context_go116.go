@@ -0,0 +1,9 @@
+//go:build !go1.17
+// +build !go1.17
+
+package check
+
+import "go/build"
+
+func setToolTags(c *build.Context) {
+}
@@ -0,0 +1,43 @@
+//go:build go1.17
+// +build go1.17
+
+package check
+
+import (
+	"go/build"
+	"runtime"
+	"strings"
+)
+
+// regabiArchs are the architectures using the register based calling
+// convention, which selects files of internal/abi and runtime.
+var regabiArchs = map[string]bool{
+	"amd64": true, "arm64": true, "loong64": true, "ppc64": true, "ppc64le": true, "riscv64": true,
+}
+
+var archLevelTags = map[string]string{
+	"amd64": "amd64.v1",
+	"386":   "386.sse2",
+}
+
+// setToolTags replaces the tool tags of the host architecture in c by the
+// tags of c.GOARCH, so the standard library is checked for c.GOARCH.
+func setToolTags(c *build.Context) {
+	if c.GOARCH == runtime.GOARCH {
+		return
+	}
+	var tags []string
+	for _, tag := range c.ToolTags {
+		if strings.HasPrefix(tag, runtime.GOARCH+".") {
+			continue
+		}
+		if strings.HasPrefix(tag, "goexperiment.regabi") && !regabiArchs[c.GOARCH] {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	if tag, ok := archLevelTags[c.GOARCH]; ok {
+		tags = append(tags, tag)
+	}
+	c.ToolTags = tags
+}
@@ -0,0 +1,94 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package complete
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runComplete,
+	UsageLine: "complete -pos file.go:offset|file.go:line:column [-posenc byte|rune|utf16] [-stdin]",
+	Short:     "golang code completion",
+	Long: `Complete prints the completion candidates at the cursor, one per line as
+kind,,name,,type,,doc with newlines in the doc escaped as \n and backslashes as \\,
+and for not yet imported packages ,,import path.`,
+}
+
+var (
+	completePos    string
+	completeStdin  bool
+	completeTags   string
+	completePosEnc string
+)
+
+func init() {
+	Command.Flag.StringVar(&completePos, "pos", "", "file position \"file.go:offset\" or \"file.go:line:column\"")
+	Command.Flag.StringVar(&completePosEnc, "posenc", "byte", "encoding of offsets and columns of -pos: byte, rune or utf16")
+	Command.Flag.BoolVar(&completeStdin, "stdin", false, "input file use stdin")
+	Command.Flag.StringVar(&completeTags, "tags", "", "space-separated list of build tags to apply when parsing")
+}
+
+func runComplete(cmd *command.Command, args []string) error {
+	if !strings.Contains(completePos, ":") {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	pos, err := srcpos.ParsePos(completePos)
+	if err != nil {
+		return err
+	}
+	enc, err := srcpos.ParseEncoding(completePosEnc)
+	if err != nil {
+		return err
+	}
+	filename, err := filepath.Abs(pos.Filename)
+	if err != nil {
+		return err
+	}
+	var src []byte
+	if completeStdin {
+		if src, err = ioutil.ReadAll(cmd.Stdin); err != nil {
+			return err
+		}
+	}
+	context := buildctx.System()
+	if completeTags != "" {
+		context.BuildTags = append(strings.Split(completeTags, " "), context.BuildTags...)
+	}
+	w := types.LookupPkgWalker(context)
+	defer w.ClearSourceData()
+	w.SetOutput(cmd.Stdout, cmd.Stderr)
+	w.SetFindMode(&types.FindMode{Doc: true})
+	w.PosEncoding = enc
+	if src != nil {
+		w.UpdateSourceData(filename, src, false)
+	}
+	dir, name := filepath.Split(filename)
+	dir = filepath.Clean(dir)
+	cursor := types.NewFileCursor(src, dir, name, pos.Offset)
+	cursor.SetLineColumn(pos.Line, pos.Column)
+	pkg, conf, err := w.Check(dir, types.NewPkgConfig(false, true), cursor)
+	if pkg == nil {
+		return fmt.Errorf("error import path %v", err)
+	}
+	_, list, err := w.LookupCompletions(conf, cursor)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		cmd.PrintResult(c, c.String())
+	}
+	return nil
+}
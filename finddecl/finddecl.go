@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"github.com/visualfc/gotools/pkg/buildctx"
 	"github.com/visualfc/gotools/pkg/command"
 )
 
@@ -26,11 +27,13 @@ var Command = &command.Command{
 var (
 	filePath string
 	fileLine int
+	overlay  string
 )
 
 func init() {
 	Command.Flag.StringVar(&filePath, "file", "", "file path")
 	Command.Flag.IntVar(&fileLine, "line", -1, "file line")
+	Command.Flag.StringVar(&overlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
 }
 
 func runFindDecl(cmd *command.Command, args []string) error {
@@ -45,29 +48,36 @@ func runFindDecl(cmd *command.Command, args []string) error {
 		}
 		filePath = filepath.Join(dir, filePath)
 	}
+	if overlay != "" {
+		if _, err := buildctx.LoadOverlay(overlay, cmd.Stdin); err != nil {
+			return err
+		}
+		defer buildctx.SetOverlay(nil)
+	}
 
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, filePath, nil, 0)
+	f, err := parser.ParseFile(fset, filePath, buildctx.FileSource(filePath), 0)
 	if err != nil {
 		return err
 	}
 	decl := findDecl(fset, f, fileLine)
 	if decl == nil {
-		fmt.Println("-")
+		cmd.Println("-")
 		return errors.New("error find decl")
 	}
-	printDecl(fset, decl, fileLine)
+	info := declInfo(fset, decl, fileLine)
+	cmd.PrintResult(info, fmt.Sprint(info.Type, " ", info.Name, " ", info.BeginLine, " ", info.EndLine))
 	return nil
 }
 
 type Info struct {
-	Type      string
-	Name      string
-	BeginLine int
-	EndLine   int
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	BeginLine int    `json:"beginLine"`
+	EndLine   int    `json:"endLine"`
 }
 
-func printDecl(fset *token.FileSet, decl ast.Decl, line int) {
+func declInfo(fset *token.FileSet, decl ast.Decl, line int) *Info {
 	var tag string
 	var name string
 
@@ -122,7 +132,7 @@ func printDecl(fset *token.FileSet, decl ast.Decl, line int) {
 		tag = "func"
 		name = d.Name.Name
 	}
-	fmt.Println(tag, name, fset.Position(decl.Pos()).Line, fset.Position(decl.End()).Line)
+	return &Info{tag, name, fset.Position(decl.Pos()).Line, fset.Position(decl.End()).Line}
 }
 
 func findDecl(fset *token.FileSet, file *ast.File, line int) ast.Decl {
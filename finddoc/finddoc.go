@@ -43,7 +43,10 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/visualfc/gotools/pkg/buildctx"
 	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/pkgcache"
+	gotypes "github.com/visualfc/gotools/types"
 )
 
 const usageDoc = `Find documentation for names.
@@ -168,12 +171,21 @@ func runDoc(cmd *command.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "doc: package name cannot contain slash (TODO)\n")
 		os.Exit(2)
 	}
+	walker = nil
+	if pkgcache.Default() != nil {
+		walker = gotypes.LookupPkgWalker(buildctx.System())
+		walker.SetOutput(cmd.Stdout, cmd.Stderr)
+	}
 	for _, path := range Paths(pkg) {
 		lookInDirectory(path, name)
 	}
 	return nil
 }
 
+// walker imports the dependencies of the packages checked for method sets
+// from the export data cache, if it is enabled.
+var walker *gotypes.PkgWalker
+
 var slash = string(filepath.Separator)
 var slashDot = string(filepath.Separator) + "."
 var goRootSrcPkg = filepath.Join(runtime.GOROOT(), "src", "pkg")
@@ -347,6 +359,9 @@ func doPackage(pkg *ast.Package, fset *token.FileSet, ident string) {
 		}
 		astFiles = append(astFiles, astFile)
 	}
+	if walker != nil {
+		config.Importer = gotypes.NewImporter(walker, filepath.Dir(path))
+	}
 	config.Check(path, fset, astFiles, info) // Ignore errors.
 
 	// We need to search all files for methods, so record the full list in each file.
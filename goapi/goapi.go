@@ -31,7 +31,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/visualfc/gotools/pkg/buildctx"
 	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/srcpos"
 )
 
 var Command = &command.Command{
@@ -51,6 +53,9 @@ var apiDefaultCtx bool
 var apiCustomCtx string
 var apiLookupInfo string
 var apiLookupStdin bool
+var apiOverlay string
+var apiPosEncoding string
+var apiShowEnd bool
 var apiOutput string
 
 func init() {
@@ -62,8 +67,11 @@ func init() {
 	Command.Flag.BoolVar(&apiImportParser, "dep", true, "parser package imports")
 	Command.Flag.BoolVar(&apiDefaultCtx, "default_ctx", true, "extract for default context")
 	Command.Flag.StringVar(&apiCustomCtx, "custom_ctx", "", "optional comma-separated list of <goos>-<goarch>[-cgo] to override default contexts.")
-	Command.Flag.StringVar(&apiLookupInfo, "cursor_info", "", "lookup cursor node info\"file.go:pos\"")
+	Command.Flag.StringVar(&apiLookupInfo, "cursor_info", "", "lookup cursor node info\"file.go:pos\" or \"file.go:line:column\"")
+	Command.Flag.StringVar(&apiPosEncoding, "posenc", "byte", "encoding of cursor_info offsets and columns and of positions: byte, rune or utf16")
+	Command.Flag.BoolVar(&apiShowEnd, "end", false, "show end position of cursor_info pos")
 	Command.Flag.BoolVar(&apiLookupStdin, "cursor_std", false, "cursor_info use stdin")
+	Command.Flag.StringVar(&apiOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
 	Command.Flag.StringVar(&apiOutput, "o", "", "output file")
 }
 
@@ -92,20 +100,33 @@ func runApi(cmd *command.Command, args []string) error {
 		}
 	}
 	var curinfo CursorInfo
+	enc, err := srcpos.ParseEncoding(apiPosEncoding)
+	if err != nil {
+		return err
+	}
+	curinfo.enc = enc
 	if apiLookupInfo != "" {
-		pos := strings.Index(apiLookupInfo, ":")
-		if pos != -1 {
-			curinfo.file = (apiLookupInfo)[:pos]
-			if i, err := strconv.Atoi((apiLookupInfo)[pos+1:]); err == nil {
-				curinfo.pos = token.Pos(i)
-			}
+		if pos, err := srcpos.ParsePos(apiLookupInfo); err == nil {
+			curinfo.file = pos.Filename
+			curinfo.pos = token.Pos(pos.Offset)
+			curinfo.line, curinfo.column = pos.Line, pos.Column
 		}
 	}
 
-	if len(pkgs) == 1 && curinfo.pos != token.NoPos {
+	if len(pkgs) == 1 && (curinfo.pos != token.NoPos || curinfo.line > 0) {
 		curinfo.pkg = pkgs[0]
 	}
 
+	if apiOverlay != "" {
+		if apiOverlay == "-" && apiLookupStdin {
+			return fmt.Errorf("-overlay - and -cursor_std both read stdin")
+		}
+		if _, err := buildctx.LoadOverlay(apiOverlay, os.Stdin); err != nil {
+			return err
+		}
+		defer buildctx.SetOverlay(nil)
+	}
+
 	if apiLookupStdin {
 		src, err := ioutil.ReadAll(os.Stdin)
 		if err == nil {
@@ -246,7 +267,15 @@ lookup:
 					}
 				}
 			}
-			fmt.Println("pos,", w.fset.Position(info.T.Pos()))
+			conv := &srcpos.Converter{Encoding: w.cursorInfo.enc, ReadFile: w.cursorInfo.readFile}
+			pos, end := conv.Range(w.fset.Position(info.T.Pos()))
+			if apiShowEnd && end.IsValid() && end.Line == pos.Line {
+				fmt.Printf("pos, %v-%d\n", pos, end.Column)
+			} else if apiShowEnd && end.IsValid() {
+				fmt.Printf("pos, %v-%d:%d\n", pos, end.Line, end.Column)
+			} else {
+				fmt.Println("pos,", pos)
+			}
 		}
 		return nil
 	}
@@ -268,12 +297,38 @@ lookup:
 }
 
 type CursorInfo struct {
-	pkg  string
-	file string
-	pos  token.Pos
-	src  []byte
-	std  bool
-	info *TypeInfo
+	pkg    string
+	file   string
+	pos    token.Pos
+	line   int
+	column int
+	enc    srcpos.Encoding
+	src    []byte
+	std    bool
+	info   *TypeInfo
+}
+
+// offset returns the byte offset of the cursor in filename. The pos of the
+// cursor is the offset plus one.
+func (c *CursorInfo) offset(filename string) token.Pos {
+	if c.line == 0 && c.enc == srcpos.Byte {
+		return c.pos - 1
+	}
+	src, err := c.readFile(filename)
+	if err != nil {
+		return c.pos - 1
+	}
+	p := srcpos.Pos{Offset: int(c.pos) - 1, Line: c.line, Column: c.column}
+	return token.Pos(p.ByteOffset(src, c.enc))
+}
+
+// readFile returns the contents of filename, which are read from stdin for
+// the cursor file with -cursor_std.
+func (c *CursorInfo) readFile(filename string) ([]byte, error) {
+	if c.std && filepath.Base(filename) == c.file {
+		return c.src, nil
+	}
+	return buildctx.ReadFile(filename)
 }
 
 // contexts are the default contexts which are scanned, unless
@@ -963,7 +1018,7 @@ func (w *Walker) WalkPackageDir(name string, dir string, bp *build.Package) {
 	var deps []string
 
 	for _, file := range files {
-		var src interface{} = nil
+		src := buildctx.FileSource(filepath.Join(dir, file))
 		if w.cursorInfo != nil &&
 			w.cursorInfo.pkg == name &&
 			w.cursorInfo.file == file &&
@@ -1097,7 +1152,7 @@ func (w *Walker) WalkPackageDir(name string, dir string, bp *build.Package) {
 				if f == nil {
 					log.Fatalf("error fset postion %v", v.Pos())
 				}
-				info, err := w.lookupFile(v, token.Pos(f.Base())+w.cursorInfo.pos-1)
+				info, err := w.lookupFile(v, token.Pos(f.Base())+w.cursorInfo.offset(f.Name()))
 				if err != nil {
 					log.Fatalln("lookup error,", err)
 				} else {
@@ -16,6 +16,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/visualfc/gotools/pkg/buildctx"
 	"github.com/visualfc/gotools/pkg/command"
 	"github.com/visualfc/gotools/pkg/godiff"
 	"golang.org/x/tools/imports"
@@ -36,6 +37,7 @@ var (
 	gofmtFixImports   bool
 	gofmtSortImports  bool
 	gofmtUseGodiffLib bool
+	gofmtOverlay      string
 
 	// layout control
 	gofmtComments  bool
@@ -52,6 +54,7 @@ func init() {
 	Command.Flag.BoolVar(&gofmtFixImports, "fiximports", false, "updates Go import lines, adding missing ones and removing unreferenced ones")
 	Command.Flag.BoolVar(&gofmtSortImports, "sortimports", false, "sort Go import lines use goimports style")
 	Command.Flag.BoolVar(&gofmtUseGodiffLib, "godiff", true, "diff use godiff library")
+	Command.Flag.StringVar(&gofmtOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents")
 
 	// layout control
 	Command.Flag.BoolVar(&gofmtComments, "comments", true, "print comments")
@@ -89,6 +92,16 @@ func runGofmt(cmd *command.Command, args []string) error {
 		Fragment:   true,
 	}
 
+	if gofmtOverlay != "" {
+		if gofmtOverlay == "-" && len(args) == 0 {
+			return fmt.Errorf("-overlay - and -stdin both read stdin")
+		}
+		if _, err := buildctx.LoadOverlay(gofmtOverlay, cmd.Stdin); err != nil {
+			return err
+		}
+		defer buildctx.SetOverlay(nil)
+	}
+
 	if len(args) == 0 {
 		return processFile("<standard input>", cmd.Stdin, cmd.Stdout, true)
 	}
@@ -107,6 +120,18 @@ func runGofmt(cmd *command.Command, args []string) error {
 	return nil
 }
 
+// Source formats the source or source fragment src of filename as gofmt
+// with the default layout does, and with fixImports as gofmt -fiximports.
+func Source(filename string, src []byte, fixImports bool) ([]byte, error) {
+	return imports.Process(filename, src, &imports.Options{
+		FormatOnly: !fixImports,
+		TabWidth:   8,
+		TabIndent:  true,
+		Comments:   true,
+		Fragment:   true,
+	})
+}
+
 func isGoFile(f os.FileInfo) bool {
 	// ignore non-Go files
 	name := f.Name()
@@ -117,7 +142,7 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 	var src []byte
 	var err error
 	if in == nil {
-		src, err = ioutil.ReadFile(filename)
+		src, err = buildctx.ReadFile(filename)
 	} else {
 		src, err = ioutil.ReadAll(in)
 	}
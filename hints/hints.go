@@ -0,0 +1,104 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hints
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runHints,
+	UsageLine: "hints [-range line1:line2] [-stdin] [-posenc byte|rune|utf16] [-tags tags] file.go",
+	Short:     "print inlay hints of a file",
+	Long: `Hints type-checks the package of the file and prints the inlay hints of the
+file, or of the lines of -range, in source order, one per line as
+line:column kind label.
+
+The kinds are parameter for the parameter names of literal call arguments,
+type for the types of variables declared by := and range clauses, typeArgs
+for the inferred type arguments of generic calls and value for the values
+of constants declared with iota. The label is shown at the position.`,
+}
+
+var (
+	hintsRange   string
+	hintsStdin   bool
+	hintsPosEnc  string
+	hintsTags    string
+	hintsOverlay string
+)
+
+func init() {
+	Command.Flag.StringVar(&hintsRange, "range", "", "lines of the hints as line1:line2 or line")
+	Command.Flag.BoolVar(&hintsStdin, "stdin", false, "input file use stdin")
+	Command.Flag.StringVar(&hintsPosEnc, "posenc", "byte", "encoding of columns: byte, rune or utf16")
+	Command.Flag.StringVar(&hintsTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.StringVar(&hintsOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
+}
+
+// parseRange parses the lines line1:line2 or line.
+func parseRange(s string) (from, to int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	i := strings.Index(s, ":")
+	if i < 0 {
+		from, err = strconv.Atoi(s)
+		to = from
+	} else if from, err = strconv.Atoi(s[:i]); err == nil {
+		to, err = strconv.Atoi(s[i+1:])
+	}
+	if err != nil || from < 1 || to < from {
+		return 0, 0, fmt.Errorf("invalid range %q, want line1:line2", s)
+	}
+	return
+}
+
+func runHints(cmd *command.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	from, to, err := parseRange(hintsRange)
+	if err != nil {
+		return err
+	}
+	enc, err := srcpos.ParseEncoding(hintsPosEnc)
+	if err != nil {
+		return err
+	}
+	filename, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	r := &types.Request{Tags: hintsTags, Overlay: hintsOverlay, Stdin: hintsStdin}
+	defer r.Close()
+	w, err := r.Walker(cmd, filename)
+	if err != nil {
+		return err
+	}
+	w.PosEncoding = enc
+	cursor := r.Cursor(filename, 0)
+	pkg, conf, err := r.Check(filepath.Dir(filename), cursor)
+	if pkg == nil {
+		return fmt.Errorf("error import path %v", err)
+	}
+	list, err := w.LookupInlayHints(conf, cursor, from, to)
+	if err != nil {
+		return err
+	}
+	for _, h := range list {
+		cmd.PrintResult(h, fmt.Sprintf("%d:%d %s %s", h.Line, h.Column, h.Kind, h.Label))
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/visualfc/gotools/gofmt"
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runImpl,
+	UsageLine: "impl -iface iface [-type recv] [-edit] [-w] [-posenc byte|rune|utf16] [-tags tags] [file.go:pos|dir]",
+	Short:     "generate method stubs implementing an interface",
+	Long: `Impl generates the stubs of the methods of the interface iface that the type
+recv of the package in dir, by default the current directory, or the type at
+the cursor file.go:offset or file.go:line:column is missing.
+
+The receiver is T, *T or t *T. For the type at the cursor the receiver name
+and pointer follow its existing methods. The interface is a name of the
+package, pkg.Name of an imported package or importpath.Name, as
+io.ReadWriteCloser. The doc comments of the interface methods are copied.
+
+Impl prints the stubs, with -edit the edits inserting them after the type
+declaration and adding the imports they need, one per line sorted by offset
+as file::offset::length::text, and with -w it writes the edits to the file.
+The stubs are formatted; the rest of the file is not changed.`,
+}
+
+var (
+	implIface   string
+	implType    string
+	implEdit    bool
+	implWrite   bool
+	implPosEnc  string
+	implTags    string
+	implOverlay string
+)
+
+func init() {
+	Command.Flag.StringVar(&implIface, "iface", "", "interface to implement, as io.Reader")
+	Command.Flag.StringVar(&implType, "type", "", "receiver type, as T, *T or t *T (default the type at the cursor)")
+	Command.Flag.BoolVar(&implEdit, "edit", false, "print the edits inserting the stubs after the type declaration")
+	Command.Flag.BoolVar(&implWrite, "w", false, "write the edits to the file")
+	Command.Flag.StringVar(&implPosEnc, "posenc", "byte", "encoding of cursor and edit offsets and columns: byte, rune or utf16")
+	Command.Flag.StringVar(&implTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.StringVar(&implOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
+}
+
+func runImpl(cmd *command.Command, args []string) error {
+	if implIface == "" || len(args) > 1 || (implType == "" && len(args) == 0) {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	enc, err := srcpos.ParseEncoding(implPosEnc)
+	if err != nil {
+		return err
+	}
+	r := &types.Request{Tags: implTags, Overlay: implOverlay}
+	defer r.Close()
+	w, err := r.Walker(cmd, "")
+	if err != nil {
+		return err
+	}
+	w.SetFindMode(&types.FindMode{Doc: true})
+	w.PosEncoding = enc
+
+	dir := "."
+	var cursor *types.FileCursor
+	if len(args) == 1 {
+		dir = args[0]
+		if implType == "" {
+			pos, err := srcpos.ParsePos(args[0])
+			if err != nil {
+				return err
+			}
+			filename, err := filepath.Abs(pos.Filename)
+			if err != nil {
+				return err
+			}
+			dir = filepath.Dir(filename)
+			cursor = r.Cursor(filename, pos.Offset)
+			if pos.Line > 0 {
+				cursor.SetLineColumn(pos.Line, pos.Column)
+			}
+		} else if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+	pkg, conf, err := r.Check(dir, cursor)
+	if pkg == nil {
+		return fmt.Errorf("error import path %v", err)
+	}
+	stubs, err := w.ImplementStubs(conf, cursor, implType, implIface)
+	if err != nil {
+		return err
+	}
+	if len(stubs.Methods) == 0 {
+		return fmt.Errorf("%v implements %v", stubs.Type, stubs.Interface)
+	}
+	if !implEdit && !implWrite {
+		code, err := gofmt.Source(stubs.Filename, []byte(stubs.Code), false)
+		if err != nil {
+			return err
+		}
+		stubs.Code = string(code)
+		cmd.PrintResult(stubs, strings.TrimRight(stubs.Code, "\n"))
+		return nil
+	}
+
+	src, err := buildctx.ReadFile(stubs.Filename)
+	if err != nil {
+		return err
+	}
+	edits, err := stubEdits(stubs, src)
+	if err != nil {
+		return err
+	}
+	if implWrite {
+		info, err := os.Stat(stubs.Filename)
+		if err != nil {
+			return err
+		}
+		out := src
+		for i := len(edits) - 1; i >= 0; i-- {
+			e := edits[i]
+			out = append(append(append([]byte{}, out[:e.offset]...), e.text...), out[e.offset+e.length:]...)
+		}
+		if err := ioutil.WriteFile(stubs.Filename, out, info.Mode()); err != nil {
+			return err
+		}
+		types.InvalidateCache(stubs.Filename)
+	}
+	if implEdit {
+		for _, e := range edits {
+			offset := srcpos.Count(src[:e.offset], enc)
+			length := srcpos.Count(src[e.offset:e.offset+e.length], enc)
+			lineStart := bytes.LastIndexByte(src[:e.offset], '\n') + 1
+			res := &types.Result{Kind: "edit", Filename: stubs.Filename,
+				Line: bytes.Count(src[:e.offset], []byte("\n")) + 1, Column: srcpos.Count(src[lineStart:e.offset], enc) + 1,
+				Offset: offset, Length: length, Text: e.text}
+			cmd.PrintResult(res, fmt.Sprintf("%s::%d::%d::%s", stubs.Filename, offset, length, e.text))
+		}
+	}
+	return nil
+}
+
+// textEdit replaces length bytes at offset of a file by text.
+type textEdit struct {
+	offset int
+	length int
+	text   string
+}
+
+// stubEdits returns the edits of src, sorted by offset, inserting the
+// formatted stubs after the type declaration and adding their imports. The
+// rest of src is not changed.
+func stubEdits(stubs *types.ImplStubs, src []byte) ([]*textEdit, error) {
+	if stubs.Offset > len(src) {
+		return nil, fmt.Errorf("%s: invalid offset %d", stubs.Filename, stubs.Offset)
+	}
+	code, err := gofmt.Source(stubs.Filename, []byte(stubs.Code), false)
+	if err != nil {
+		return nil, err
+	}
+	insert := &textEdit{offset: stubs.Offset, text: "\n\n" + strings.TrimRight(string(code), "\n")}
+	if len(stubs.Imports) == 0 {
+		return []*textEdit{insert}, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, stubs.Filename, src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	return append(importEdits(fset, f, src, stubs.Imports), insert), nil
+}
+
+// importEdits returns the edits of src adding the sorted import paths to
+// the last import declaration of f, or after the package clause.
+func importEdits(fset *token.FileSet, f *ast.File, src []byte, paths []string) []*textEdit {
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	lineStart := func(offset int) int {
+		return bytes.LastIndexByte(src[:offset], '\n') + 1
+	}
+	var last *ast.GenDecl
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			last = d
+		}
+	}
+	var specs []string
+	for _, path := range paths {
+		specs = append(specs, strconv.Quote(path))
+	}
+	switch {
+	case last == nil:
+		text := "\n\nimport " + specs[0]
+		if len(specs) > 1 {
+			text = "\n\nimport (\n\t" + strings.Join(specs, "\n\t") + "\n)"
+		}
+		return []*textEdit{{offset: offset(f.Name.End()), text: text}}
+	case !last.Lparen.IsValid():
+		// import "fmt" becomes a group
+		spec := last.Specs[0].(*ast.ImportSpec)
+		path, _ := strconv.Unquote(spec.Path.Value)
+		i := sort.SearchStrings(paths, path)
+		lines := append(append(append([]string{}, specs[:i]...), string(src[offset(spec.Pos()):offset(spec.End())])), specs[i:]...)
+		return []*textEdit{{offset: offset(last.Pos()), length: offset(last.End()) - offset(last.Pos()),
+			text: "import (\n\t" + strings.Join(lines, "\n\t") + "\n)"}}
+	}
+	var edits []*textEdit
+	for i, path := range paths {
+		at := lineStart(offset(last.Rparen))
+		for _, spec := range last.Specs {
+			if p, _ := strconv.Unquote(spec.(*ast.ImportSpec).Path.Value); p > path {
+				at = lineStart(offset(spec.Pos()))
+				break
+			}
+		}
+		if n := len(edits); n > 0 && edits[n-1].offset == at {
+			edits[n-1].text += "\t" + specs[i] + "\n"
+		} else {
+			edits = append(edits, &textEdit{offset: at, text: "\t" + specs[i] + "\n"})
+		}
+	}
+	return edits
+}
@@ -0,0 +1,513 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/visualfc/gotools/astview"
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runLsp,
+	UsageLine: "lsp",
+	Short:     "language server protocol on stdio",
+	Long: `Lsp runs a Language Server Protocol server on stdin and stdout.
+
+The server maps the protocol methods to the registered commands:
+	textDocument/hover           types -info -doc
+	textDocument/definition      types -def
+	textDocument/references      types -use -def [-all]
+	textDocument/documentSymbol  astview -outline
+	textDocument/formatting      gofmt
+	workspace/executeCommand     gotools.pkgs runs pkgs -list
+
+Unsaved buffers opened by didOpen/didChange are passed to the types command
+as an overlay and to the other commands of a document as stdin.`,
+	Streaming: true,
+}
+
+func runLsp(cmd *command.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	return NewServer(cmd.Stdin, cmd.Stdout).Run()
+}
+
+// Server is a language server reading requests from in and writing
+// responses to out.
+type Server struct {
+	in         *bufio.Reader
+	out        io.Writer
+	overlays   map[string][]byte // document uri -> text
+	usageAll   bool
+	skipGoroot bool
+	shutdown   bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	types.EnableWalkerCache(true)
+	return &Server{
+		in:       bufio.NewReader(in),
+		out:      out,
+		overlays: make(map[string][]byte),
+	}
+}
+
+var errExit = fmt.Errorf("exit")
+
+// Run serves messages until the exit notification or the end of input.
+func (s *Server) Run() error {
+	for {
+		msg, err := ReadMessage(s.in)
+		if e, ok := err.(*ResponseError); ok {
+			// the message was read, so the next one can be
+			null := json.RawMessage("null")
+			if err := WriteMessage(s.out, &Message{ID: &null, Error: e}); err != nil {
+				return err
+			}
+			continue
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		result, err := s.handle(msg)
+		if err == errExit {
+			return nil
+		}
+		if msg.ID == nil {
+			continue
+		}
+		resp := &Message{ID: msg.ID}
+		if err != nil {
+			if e, ok := err.(*ResponseError); ok {
+				resp.Error = e
+			} else {
+				resp.Error = &ResponseError{Code: codeInternalError, Message: err.Error()}
+			}
+		} else {
+			resp.Result, err = json.Marshal(result)
+			if err != nil {
+				return err
+			}
+		}
+		if err := WriteMessage(s.out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v: %v", msg.Method, r)
+		}
+	}()
+	if s.shutdown && msg.Method != "exit" {
+		if msg.ID == nil {
+			return nil, nil
+		}
+		return nil, &ResponseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		s.usageAll = params.InitializationOptions.UsageAll
+		s.skipGoroot = params.InitializationOptions.SkipGoroot
+		r := &InitializeResult{}
+		r.ServerInfo.Name = command.AppName
+		r.ServerInfo.Version = command.AppVersion
+		r.Capabilities = ServerCapabilities{
+			TextDocumentSync:           1, // full
+			HoverProvider:              true,
+			DefinitionProvider:         true,
+			ReferencesProvider:         true,
+			DocumentSymbolProvider:     true,
+			DocumentFormattingProvider: true,
+			ExecuteCommandProvider:     &ExecuteCommandOptions{Commands: []string{"gotools.pkgs"}},
+		}
+		return r, nil
+	case "initialized", "$/cancelRequest", "textDocument/didSave":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "exit":
+		return nil, errExit
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		s.overlays[params.TextDocument.URI] = []byte(params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		for _, change := range params.ContentChanges {
+			if change.Range != nil {
+				return nil, &ResponseError{Code: codeInvalidParams, Message: "only full document sync is supported"}
+			}
+			s.overlays[params.TextDocument.URI] = []byte(change.Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.overlays, params.TextDocument.URI)
+		types.InvalidateCache(uriToPath(params.TextDocument.URI))
+		return nil, nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(&params)
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(&params)
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.references(&params)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.documentSymbol(&params)
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.formatting(&params)
+	case "workspace/executeCommand":
+		var params ExecuteCommandParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.executeCommand(&params)
+	}
+	if msg.ID == nil {
+		return nil, nil
+	}
+	return nil, &ResponseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func unmarshalParams(msg *Message, v interface{}) error {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// run runs the command args in -json mode and returns the output envelope.
+func (s *Server) run(stdin []byte, args ...string) (*command.Output, error) {
+	var stdout, stderr bytes.Buffer
+	err := command.RunArgs(append([]string{"-json"}, args...), bytes.NewReader(stdin), &stdout, &stderr)
+	out := &command.Output{}
+	if e := json.Unmarshal(stdout.Bytes(), out); e != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, e
+	}
+	return out, nil
+}
+
+// runTypes runs the types command at the cursor of params with the open
+// documents as overlay.
+func (s *Server) runTypes(params *TextDocumentPositionParams, flags ...string) ([]*types.Result, error) {
+	filename := uriToPath(params.TextDocument.URI)
+	src, err := s.readFile(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset := offsetOf(src, params.Position)
+	args := []string{"types", "-pos", filepath.Base(filename) + ":" + strconv.Itoa(offset)}
+	var stdin []byte
+	if len(s.overlays) > 0 {
+		overlay := make(map[string]string)
+		for uri, text := range s.overlays {
+			overlay[uriToPath(uri)] = string(text)
+		}
+		if stdin, err = json.Marshal(overlay); err != nil {
+			return nil, err
+		}
+		args = append(args, "-overlay", "-")
+	}
+	args = append(args, flags...)
+	args = append(args, filepath.Dir(filename))
+	out, err := s.run(stdin, args...)
+	if err != nil {
+		return nil, err
+	}
+	var results []*types.Result
+	for _, v := range out.Results {
+		data, _ := json.Marshal(v)
+		r := &types.Result{}
+		if json.Unmarshal(data, r) == nil {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func (s *Server) hover(params *TextDocumentPositionParams) (*Hover, error) {
+	results, err := s.runTypes(params, "-info", "-def", "-doc")
+	if err != nil {
+		return nil, err
+	}
+	var info, doc []string
+	for _, r := range results {
+		switch r.Kind {
+		case "info":
+			info = append(info, r.Text)
+		case "doc":
+			doc = append(doc, strings.TrimSpace(r.Text))
+		}
+	}
+	if len(info) == 0 {
+		return nil, nil
+	}
+	value := "```go\n" + strings.Join(info, "\n") + "\n```"
+	if len(doc) > 0 {
+		value += "\n\n" + strings.Join(doc, "\n\n")
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}}, nil
+}
+
+func (s *Server) definition(params *TextDocumentPositionParams) ([]*Location, error) {
+	results, err := s.runTypes(params, "-def")
+	if err != nil {
+		return nil, err
+	}
+	return s.locations(results, "def"), nil
+}
+
+func (s *Server) references(params *ReferenceParams) ([]*Location, error) {
+	flags := []string{"-use", "-def"}
+	if s.usageAll {
+		flags = append(flags, "-all")
+	}
+	if s.skipGoroot {
+		flags = append(flags, "-skip_goroot")
+	}
+	results, err := s.runTypes(&params.TextDocumentPositionParams, flags...)
+	if err != nil {
+		return nil, err
+	}
+	if !params.Context.IncludeDeclaration {
+		// the usages include the declaration
+		var uses []*types.Result
+		for _, r := range results {
+			if r.Kind == "usage" && !isDefinition(results, r) {
+				uses = append(uses, r)
+			}
+		}
+		results = uses
+	}
+	return s.locations(results, "usage"), nil
+}
+
+// isDefinition reports whether r is at the position of a def result.
+func isDefinition(results []*types.Result, r *types.Result) bool {
+	for _, def := range results {
+		if def.Kind == "def" && def.Filename == r.Filename && def.Line == r.Line && def.Column == r.Column {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) locations(results []*types.Result, kind string) []*Location {
+	locs := []*Location{}
+	conv := s.converter()
+	for _, r := range results {
+		if r.Kind != kind || r.Filename == "" {
+			continue
+		}
+		pos := token.Position{Filename: r.Filename, Line: r.Line, Column: r.Column}
+		start := conv.Position(pos)
+		end := start
+		if r.EndLine > 0 {
+			end = conv.Position(token.Position{Filename: r.Filename, Line: r.EndLine, Column: r.EndColumn})
+		} else if e := conv.End(pos); e.IsValid() {
+			end = conv.Position(e)
+		}
+		locs = append(locs, &Location{URI: pathToURI(r.Filename), Range: Range{toPosition(start), toPosition(end)}})
+	}
+	return locs
+}
+
+var symbolKinds = map[string]SymbolKind{
+	"p":  SymbolPackage,
+	"t":  SymbolClass,
+	"s":  SymbolStruct,
+	"i":  SymbolInterface,
+	"v":  SymbolVariable,
+	"c":  SymbolConstant,
+	"f":  SymbolFunction,
+	"tv": SymbolField,
+	"tm": SymbolMethod,
+}
+
+func (s *Server) documentSymbol(params *DocumentSymbolParams) ([]*DocumentSymbol, error) {
+	uri := params.TextDocument.URI
+	src, err := s.readFile(uri)
+	if err != nil {
+		return nil, err
+	}
+	filename := uriToPath(uri)
+	out, err := s.run(src, "astview", "-stdin", "-outline", "-end", filename)
+	if err != nil {
+		return nil, err
+	}
+	conv := s.converter()
+	type level struct {
+		n   int
+		sym *DocumentSymbol
+	}
+	var symbols []*DocumentSymbol
+	var stack []level
+	for _, v := range out.Results {
+		data, _ := json.Marshal(v)
+		var item astview.Item
+		if json.Unmarshal(data, &item) != nil || item.Line == 0 {
+			continue
+		}
+		kind, ok := symbolKinds[item.Tag]
+		if !ok {
+			continue
+		}
+		if kind == SymbolFunction && strings.HasPrefix(item.Name, "(") {
+			kind = SymbolMethod
+		}
+		start := toPosition(conv.Position(token.Position{Filename: filename, Line: item.Line, Column: item.Column}))
+		end := toPosition(conv.Position(token.Position{Filename: filename, Line: item.EndLine, Column: item.EndColumn}))
+		sym := &DocumentSymbol{
+			Name:           item.Name,
+			Detail:         item.Info,
+			Kind:           kind,
+			Range:          Range{start, end},
+			SelectionRange: Range{start, start},
+		}
+		for len(stack) > 0 && stack[len(stack)-1].n >= item.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 || kind == SymbolPackage {
+			symbols = append(symbols, sym)
+		} else {
+			parent := stack[len(stack)-1].sym
+			parent.Children = append(parent.Children, sym)
+		}
+		if kind != SymbolPackage {
+			stack = append(stack, level{item.Level, sym})
+		}
+	}
+	return symbols, nil
+}
+
+func (s *Server) formatting(params *DocumentFormattingParams) ([]*TextEdit, error) {
+	uri := params.TextDocument.URI
+	src, err := s.readFile(uri)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	err = command.RunArgs([]string{"gofmt"}, bytes.NewReader(src), &stdout, &stderr)
+	if err != nil {
+		return nil, err
+	}
+	if stderr.Len() > 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+	}
+	if bytes.Equal(src, stdout.Bytes()) {
+		return []*TextEdit{}, nil
+	}
+	last := bytes.LastIndexByte(src, '\n') + 1
+	end := Position{Line: bytes.Count(src, []byte("\n")), Character: srcpos.Count(src[last:], srcpos.UTF16)}
+	return []*TextEdit{{Range: Range{Position{}, end}, NewText: stdout.String()}}, nil
+}
+
+func (s *Server) executeCommand(params *ExecuteCommandParams) (interface{}, error) {
+	switch params.Command {
+	case "gotools.pkgs":
+		out, err := s.run(nil, "pkgs", "-list")
+		if err != nil {
+			return nil, err
+		}
+		return out.Results, nil
+	}
+	return nil, &ResponseError{Code: codeInvalidParams, Message: "unknown command: " + params.Command}
+}
+
+func (s *Server) readFile(uri string) ([]byte, error) {
+	if src, ok := s.overlays[uri]; ok {
+		return src, nil
+	}
+	return ioutil.ReadFile(uriToPath(uri))
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
+
+// converter returns the converter of the byte positions of the command
+// results to the UTF-16 positions of the protocol, with the open documents.
+func (s *Server) converter() *srcpos.Converter {
+	return &srcpos.Converter{Encoding: srcpos.UTF16, ReadFile: func(filename string) ([]byte, error) {
+		return s.readFile(pathToURI(filename))
+	}}
+}
+
+// toPosition returns the protocol position of the position pos converted
+// to UTF-16 columns.
+func toPosition(pos token.Position) Position {
+	return Position{Line: pos.Line - 1, Character: pos.Column - 1}
+}
+
+// offsetOf returns the byte offset in src of the protocol position pos.
+func offsetOf(src []byte, pos Position) int {
+	return srcpos.Pos{Line: pos.Line + 1, Column: pos.Character + 1}.ByteOffset(src, srcpos.UTF16)
+}
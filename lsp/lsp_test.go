@@ -0,0 +1,224 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/visualfc/gotools/astview"
+	"github.com/visualfc/gotools/gofmt"
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/types"
+)
+
+func init() {
+	command.Register(types.Command)
+	command.Register(astview.Command)
+	command.Register(gofmt.Command)
+}
+
+// client is an in-process LSP client connected to a Server by pipes.
+type client struct {
+	t    *testing.T
+	in   *bufio.Reader
+	out  io.WriteCloser
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	c := &client{t: t, in: bufio.NewReader(cr), out: cw, done: make(chan error, 1)}
+	go func() {
+		err := NewServer(sr, sw).Run()
+		sw.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) notify(method string, params interface{}) {
+	data, _ := json.Marshal(params)
+	if err := WriteMessage(c.out, &Message{Method: method, Params: data}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// request sends the request and returns the response.
+func (c *client) request(method string, params interface{}) *Message {
+	c.id++
+	id := json.RawMessage(strings.TrimSpace(string(mustMarshal(c.id))))
+	data, _ := json.Marshal(params)
+	if err := WriteMessage(c.out, &Message{ID: &id, Method: method, Params: data}); err != nil {
+		c.t.Fatal(err)
+	}
+	resp, err := ReadMessage(c.in)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+func (c *client) call(method string, params interface{}, result interface{}) {
+	resp := c.request(method, params)
+	if resp.Error != nil {
+		c.t.Fatalf("%v: %v", method, resp.Error)
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			c.t.Fatalf("%v: %v", method, err)
+		}
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+var testSource = `package main
+
+import "fmt"
+
+// hello returns a greeting.
+func hello(name string) string {
+	return "你好, " + name
+}
+
+type Greeter struct {
+	Name string
+}
+
+func (g *Greeter) Greet() {
+	fmt.Println(hello(g.Name))
+}
+
+func main() {
+	g := &Greeter{Name: "gopher"}
+	g.Greet()
+}
+`
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/hello\n"), 0644)
+	filename := filepath.Join(dir, "main.go")
+	// the file on disk is stale, the server must use the overlay.
+	ioutil.WriteFile(filename, []byte("package main\n"), 0644)
+	uri := pathToURI(filename)
+
+	c := newClient(t)
+	var init InitializeResult
+	c.call("initialize", &InitializeParams{RootURI: pathToURI(dir)}, &init)
+	if !init.Capabilities.HoverProvider {
+		t.Fatal("hover not supported")
+	}
+	c.notify("initialized", struct{}{})
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: testSource},
+	})
+
+	// hello(g.Name) in Greet
+	pos := Position{Line: 14, Character: 13}
+	params := &TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: pos}
+
+	var hover Hover
+	c.call("textDocument/hover", params, &hover)
+	if !strings.Contains(hover.Contents.Value, "func hello(name string) string") ||
+		!strings.Contains(hover.Contents.Value, "hello returns a greeting.") {
+		t.Fatalf("hover: %q", hover.Contents.Value)
+	}
+
+	var defs []*Location
+	c.call("textDocument/definition", params, &defs)
+	if len(defs) != 1 || defs[0].URI != uri || defs[0].Range.Start.Line != 5 || defs[0].Range.Start.Character != 5 {
+		t.Fatalf("definition: %+v", defs)
+	}
+
+	var refs []*Location
+	c.call("textDocument/references", &ReferenceParams{TextDocumentPositionParams: *params}, &refs)
+	if len(refs) != 1 || refs[0].Range.Start.Line != 14 {
+		t.Fatalf("references: %+v", refs)
+	}
+	// the other open buffers are seen too
+	other := pathToURI(filepath.Join(dir, "other.go"))
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: other, LanguageID: "go", Version: 1, Text: "package main\n\nvar other = hello(\"x\")\n"},
+	})
+	refParams := &ReferenceParams{TextDocumentPositionParams: *params}
+	refParams.Context.IncludeDeclaration = true
+	c.call("textDocument/references", refParams, &refs)
+	if len(refs) != 3 {
+		t.Fatalf("references with declaration: %+v", refs)
+	}
+
+	var symbols []*DocumentSymbol
+	c.call("textDocument/documentSymbol", &DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols)
+	var names []string
+	for _, sym := range symbols {
+		names = append(names, sym.Name)
+		for _, child := range sym.Children {
+			names = append(names, sym.Name+"."+child.Name)
+		}
+	}
+	if got := strings.Join(names, " "); got != "main hello Greeter Greeter.Name (*Greeter).Greet main" {
+		t.Fatalf("documentSymbol: %v", got)
+	}
+
+	unformatted := strings.Replace(testSource, "\tg.Greet()", "g.Greet( )", 1)
+	c.notify("textDocument/didChange", &DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: unformatted}},
+	})
+	var edits []*TextEdit
+	c.call("textDocument/formatting", &DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits)
+	if len(edits) != 1 || edits[0].NewText != testSource {
+		t.Fatalf("formatting: %+v", edits)
+	}
+
+	// a message that is not JSON gets a parse error
+	if _, err := io.WriteString(c.out, "Content-Length: 3\r\n\r\n{x}"); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := ReadMessage(c.in); err != nil || resp.Error == nil || resp.Error.Code != codeParseError {
+		t.Fatalf("parse error: %+v %v", resp, err)
+	}
+	c.call("shutdown", nil, nil)
+	if resp := c.request("textDocument/hover", params); resp.Error == nil || resp.Error.Code != codeInvalidRequest {
+		t.Fatalf("request after shutdown: %+v", resp)
+	}
+	c.notify("exit", nil)
+	c.out.Close()
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	src := []byte("a\n// 你好𝄞x\n")
+	filename := filepath.FromSlash("/src/a.go")
+	s := &Server{overlays: map[string][]byte{pathToURI(filename): src}}
+	offset := strings.Index(string(src), "x")
+	conv := s.converter()
+	start, end := conv.Range(token.Position{Filename: filename, Line: 2, Column: offset - 1})
+	if pos := toPosition(start); pos != (Position{Line: 1, Character: 7}) {
+		t.Fatalf("start: %+v", pos)
+	}
+	if pos := toPosition(end); pos != (Position{Line: 1, Character: 8}) {
+		t.Fatalf("end: %+v", pos)
+	}
+	if n := offsetOf(src, toPosition(start)); n != offset {
+		t.Fatalf("offsetOf: %v != %v", n, offset)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// The subset of the Language Server Protocol used by the server.
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type TextDocumentContentChangeEvent struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   TextDocumentIdentifier           `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+type DocumentSymbolParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+type InitializeParams struct {
+	RootURI               string `json:"rootUri,omitempty"`
+	InitializationOptions struct {
+		UsageAll   bool `json:"usageAll"`
+		SkipGoroot bool `json:"skipGoroot"`
+	} `json:"initializationOptions"`
+}
+
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	} `json:"serverInfo"`
+}
+
+type ServerCapabilities struct {
+	TextDocumentSync           int                    `json:"textDocumentSync"`
+	HoverProvider              bool                   `json:"hoverProvider"`
+	DefinitionProvider         bool                   `json:"definitionProvider"`
+	ReferencesProvider         bool                   `json:"referencesProvider"`
+	DocumentSymbolProvider     bool                   `json:"documentSymbolProvider"`
+	DocumentFormattingProvider bool                   `json:"documentFormattingProvider"`
+	ExecuteCommandProvider     *ExecuteCommandOptions `json:"executeCommandProvider,omitempty"`
+}
+
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+}
+
+type SymbolKind int
+
+const (
+	SymbolPackage   SymbolKind = 4
+	SymbolClass     SymbolKind = 5
+	SymbolMethod    SymbolKind = 6
+	SymbolField     SymbolKind = 8
+	SymbolInterface SymbolKind = 11
+	SymbolFunction  SymbolKind = 12
+	SymbolVariable  SymbolKind = 13
+	SymbolConstant  SymbolKind = 14
+	SymbolStruct    SymbolKind = 23
+)
+
+type DocumentSymbol struct {
+	Name           string            `json:"name"`
+	Detail         string            `json:"detail,omitempty"`
+	Kind           SymbolKind        `json:"kind"`
+	Range          Range             `json:"range"`
+	SelectionRange Range             `json:"selectionRange"`
+	Children       []*DocumentSymbol `json:"children,omitempty"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// JSON-RPC 2.0 messages.
+
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%v (%v)", e.Message, e.Code)
+}
+
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// ReadMessage reads one message framed by the Content-Length header. A
+// message that is not JSON is read and a parse error returned as
+// *ResponseError.
+func ReadMessage(r *bufio.Reader) (*Message, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %v", err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, &ResponseError{Code: codeParseError, Message: err.Error()}
+	}
+	return msg, nil
+}
+
+// WriteMessage writes one message framed by the Content-Length header.
+func WriteMessage(w io.Writer, msg *Message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -6,6 +6,9 @@ package main
 
 import (
 	"github.com/visualfc/gotools/astview"
+	"github.com/visualfc/gotools/cache"
+	"github.com/visualfc/gotools/check"
+	"github.com/visualfc/gotools/complete"
 	"github.com/visualfc/gotools/debugflags"
 	"github.com/visualfc/gotools/docview"
 	"github.com/visualfc/gotools/finddecl"
@@ -15,13 +18,21 @@ import (
 	"github.com/visualfc/gotools/gofmt"
 	"github.com/visualfc/gotools/gopresent"
 	"github.com/visualfc/gotools/gotest"
+	"github.com/visualfc/gotools/hints"
+	"github.com/visualfc/gotools/impl"
 	"github.com/visualfc/gotools/jsonfmt"
+	"github.com/visualfc/gotools/lsp"
+	"github.com/visualfc/gotools/mock"
 	"github.com/visualfc/gotools/pkg/command"
 	"github.com/visualfc/gotools/pkgcheck"
 	"github.com/visualfc/gotools/pkgs"
 	"github.com/visualfc/gotools/runcmd"
+	"github.com/visualfc/gotools/semtokens"
+	"github.com/visualfc/gotools/serve"
+	"github.com/visualfc/gotools/symbols"
 	"github.com/visualfc/gotools/terminal"
 	"github.com/visualfc/gotools/types"
+	"github.com/visualfc/gotools/unused"
 )
 
 func init() {
@@ -41,6 +52,17 @@ func init() {
 	command.Register(debugflags.Command)
 	command.Register(pkgcheck.Command)
 	command.Register(godoc.Command)
+	command.Register(serve.Command)
+	command.Register(lsp.Command)
+	command.Register(mock.Command)
+	command.Register(complete.Command)
+	command.Register(check.Command)
+	command.Register(cache.Command)
+	command.Register(symbols.Command)
+	command.Register(unused.Command)
+	command.Register(semtokens.Command)
+	command.Register(hints.Command)
+	command.Register(impl.Command)
 }
 
 func main() {
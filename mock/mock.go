@@ -0,0 +1,105 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runMock,
+	UsageLine: "mock -iface iface [-o file.go] [-name name] [-pkg name] [-tags tags] [dir]",
+	Short:     "generate a mock implementation of an interface",
+	Long: `Mock generates a mock of the interface iface for the package in dir, by
+default the directory of the -o file or the current directory.
+
+The interface is a name of the package, pkg.Name of an imported package or
+importpath.Name, as io.ReadWriteCloser. Embedded interfaces are included and
+the mock of a generic interface has its type parameters. The mock is named
+-name, by default Mock and the interface name, and has for each method M a
+field MFunc called by M, the methods ExpectM setting MFunc to return its
+arguments, MCalls returning the recorded calls with their arguments and
+MCallCount. With -pkg, as pkg_test, the mock is in another package.
+
+Mock prints the source or with -o writes it to the file if it changed, so
+it can be run by a //go:generate line.`,
+}
+
+var (
+	mockIface   string
+	mockOutput  string
+	mockName    string
+	mockPkg     string
+	mockTags    string
+	mockOverlay string
+)
+
+func init() {
+	Command.Flag.StringVar(&mockIface, "iface", "", "interface to mock, as io.Reader")
+	Command.Flag.StringVar(&mockOutput, "o", "", "output file (default stdout)")
+	Command.Flag.StringVar(&mockName, "name", "", "name of the mock type (default Mock and the interface name)")
+	Command.Flag.StringVar(&mockPkg, "pkg", "", "package name of the output file (default the package in dir)")
+	Command.Flag.StringVar(&mockTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.StringVar(&mockOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
+}
+
+func runMock(cmd *command.Command, args []string) error {
+	if mockIface == "" || len(args) > 1 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	r := &types.Request{Tags: mockTags, Overlay: mockOverlay}
+	defer r.Close()
+	w, err := r.Walker(cmd, "")
+	if err != nil {
+		return err
+	}
+
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	} else if mockOutput != "" {
+		dir = filepath.Dir(mockOutput)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+	// the package may not exist yet, as for a new directory with -pkg
+	pkg, conf, err := r.Check(dir, nil)
+	if pkg == nil {
+		if mockPkg == "" {
+			return fmt.Errorf("error import path %v", err)
+		}
+		conf = nil
+	}
+	src, err := w.GenerateMock(conf, dir, mockIface, mockName, mockPkg)
+	if err != nil {
+		return err
+	}
+	if mockOutput == "" {
+		cmd.Println(strings.TrimRight(string(src), "\n"))
+		return nil
+	}
+	filename, err := filepath.Abs(mockOutput)
+	if err != nil {
+		return err
+	}
+	if data, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(data, src) {
+		return nil
+	}
+	if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+		return err
+	}
+	types.InvalidateCache(filename)
+	return nil
+}
@@ -51,5 +51,6 @@ func NewContext(env func(key string) (string, bool)) *build.Context {
 			c.CgoEnabled = false
 		}
 	}
+	setOverlayHooks(&c)
 	return &c
 }
@@ -0,0 +1,210 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildctx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/txtar"
+)
+
+// Overlay maps absolute file names to the contents replacing the files on
+// disk, like the go command -overlay flag. A nil content deletes the file.
+type Overlay map[string][]byte
+
+var overlay Overlay
+
+// ParseOverlay parses a txtar archive or a JSON object. The JSON object maps
+// file names to contents, or is a go command overlay {"Replace": {...}}
+// mapping file names to the files holding the contents, where an empty
+// file deletes the file. Relative file names are relative to dir.
+func ParseOverlay(data []byte, dir string) (Overlay, error) {
+	abs := func(name string) string {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return filepath.Clean(name)
+	}
+	ov := make(Overlay)
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		for _, f := range txtar.Parse(data).Files {
+			ov[abs(f.Name)] = append([]byte{}, f.Data...)
+		}
+		return ov, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid overlay: %v", err)
+	}
+	if raw, ok := m["Replace"]; ok && len(m) == 1 && bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		var replace map[string]string
+		if err := json.Unmarshal(raw, &replace); err != nil {
+			return nil, fmt.Errorf("invalid overlay: %v", err)
+		}
+		for name, file := range replace {
+			if file == "" {
+				ov[abs(name)] = nil
+				continue
+			}
+			data, err := ioutil.ReadFile(abs(file))
+			if err != nil {
+				return nil, err
+			}
+			ov[abs(name)] = data
+		}
+		return ov, nil
+	}
+	for name, raw := range m {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, fmt.Errorf("invalid overlay content of %v: %v", name, err)
+		}
+		ov[abs(name)] = []byte(text)
+	}
+	return ov, nil
+}
+
+// LoadOverlay reads the overlay from the file name, or from stdin if name
+// is "-", and sets it with SetOverlay.
+func LoadOverlay(name string, stdin io.Reader) (Overlay, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dir, _ := os.Getwd()
+	ov, err := ParseOverlay(data, dir)
+	if err != nil {
+		return nil, err
+	}
+	SetOverlay(ov)
+	return ov, nil
+}
+
+// SetOverlay sets the overlay seen by the contexts of this package and by
+// build.Default. A nil overlay removes it.
+func SetOverlay(ov Overlay) {
+	overlay = ov
+	setOverlayHooks(&build.Default)
+}
+
+// lookup returns the overlay contents of filename, relative file names are
+// relative to the current directory.
+func lookup(filename string) ([]byte, bool) {
+	if overlay == nil {
+		return nil, false
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	data, ok := overlay[filepath.Clean(filename)]
+	return data, ok
+}
+
+// ReadFile returns the contents of filename from the overlay or the disk.
+func ReadFile(filename string) ([]byte, error) {
+	if data, ok := lookup(filename); ok {
+		if data == nil {
+			return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+		}
+		return data, nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// FileSource returns the contents of filename in the overlay as the src
+// argument of the go/parser functions, or nil to read the file from disk.
+func FileSource(filename string) interface{} {
+	if data, ok := lookup(filename); ok && data != nil {
+		return data
+	}
+	return nil
+}
+
+// setOverlayHooks sets the file system hooks of c to read the overlay, or
+// removes them if there is no overlay. go/build only resolves module imports
+// with the go command if no hook is set.
+func setOverlayHooks(c *build.Context) {
+	if overlay == nil {
+		c.OpenFile, c.ReadDir, c.IsDir = nil, nil, nil
+		return
+	}
+	c.OpenFile = func(path string) (io.ReadCloser, error) {
+		if _, ok := lookup(path); ok {
+			data, err := ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		return os.Open(path)
+	}
+	c.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		list, err := ioutil.ReadDir(dir)
+		dir = filepath.Clean(dir)
+		found := false
+		var infos []os.FileInfo
+		for _, info := range list {
+			if _, ok := overlay[filepath.Join(dir, info.Name())]; !ok {
+				infos = append(infos, info)
+			}
+		}
+		for name, data := range overlay {
+			if filepath.Dir(name) == dir {
+				found = true
+				if data != nil {
+					infos = append(infos, &overlayInfo{filepath.Base(name), int64(len(data))})
+				}
+			}
+		}
+		if err != nil && !found {
+			return nil, err
+		}
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Name() < infos[j].Name()
+		})
+		return infos, nil
+	}
+	c.IsDir = func(path string) bool {
+		if info, err := os.Stat(path); err == nil {
+			return info.IsDir()
+		}
+		prefix := filepath.Clean(path) + string(filepath.Separator)
+		for name := range overlay {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// overlayInfo is the os.FileInfo of a file in the overlay.
+type overlayInfo struct {
+	name string
+	size int64
+}
+
+func (f *overlayInfo) Name() string       { return f.name }
+func (f *overlayInfo) Size() int64        { return f.size }
+func (f *overlayInfo) Mode() os.FileMode  { return 0644 }
+func (f *overlayInfo) ModTime() time.Time { return time.Time{} }
+func (f *overlayInfo) IsDir() bool        { return false }
+func (f *overlayInfo) Sys() interface{}   { return nil }
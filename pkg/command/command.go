@@ -8,6 +8,7 @@ package command
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -43,9 +44,17 @@ type Command struct {
 	// flag parsing.
 	CustomFlags bool
 
+	// Streaming indicates that the command reads requests and writes
+	// responses until its input ends, as serve. Its output is not
+	// collected in the -json envelope.
+	Streaming bool
+
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
+
+	json    bool
+	results []interface{}
 }
 
 // Name returns the command's name: the first word in the usage line.
@@ -86,6 +95,99 @@ func (c *Command) Printf(format string, args ...interface{}) {
 	fmt.Fprintf(c.Stdout, format, args...)
 }
 
+// JSON reports whether the command runs with the global -json flag.
+func (c *Command) JSON() bool {
+	return c.json
+}
+
+// PrintResult prints one result of the command. In json mode v is added
+// to the results of the output envelope, otherwise text is printed as a line.
+func (c *Command) PrintResult(v interface{}, text string) {
+	if c.json {
+		c.results = append(c.results, v)
+	} else {
+		fmt.Fprintln(c.Stdout, text)
+	}
+}
+
+// Output is the envelope printed by a command run with the global -json flag.
+// Results holds the objects added by PrintResult, or the output lines of
+// commands without structured results. Errors holds the error returned by
+// the command and the lines it printed to stderr.
+type Output struct {
+	Command string        `json:"command"`
+	Results []interface{} `json:"results"`
+	Errors  []string      `json:"errors"`
+}
+
+var JSONOutput bool
+
+func init() {
+	globalFlags(flag.CommandLine)
+}
+
+func globalFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&JSONOutput, "json", false, "print command output as json")
+}
+
+func splitLines(data []byte, skipEmpty bool) (lines []string) {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" || !skipEmpty {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+// jsonMode reports whether the output of cmd is printed in the -json envelope.
+func jsonMode(cmd *Command) bool {
+	return JSONOutput && !cmd.Streaming
+}
+
+func runCommand(cmd *Command, args []string) error {
+	if !jsonMode(cmd) {
+		return cmd.Run(cmd, args)
+	}
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	var outbuf, errbuf bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &outbuf, &errbuf
+	cmd.json = true
+	cmd.results = nil
+	defer func() {
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		cmd.json = false
+		cmd.results = nil
+	}()
+	err := cmd.Run(cmd, args)
+	out := &Output{Command: cmd.Name(), Results: cmd.results, Errors: splitLines(errbuf.Bytes(), true)}
+	if out.Results == nil {
+		for _, line := range splitLines(outbuf.Bytes(), false) {
+			out.Results = append(out.Results, line)
+		}
+	}
+	if out.Results == nil {
+		out.Results = []interface{}{}
+	}
+	if err != nil {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	if out.Errors == nil {
+		out.Errors = []string{}
+	}
+	data, e := json.MarshalIndent(out, "", "\t")
+	if e != nil {
+		return e
+	}
+	stdout.Write(data)
+	stdout.Write([]byte{'\n'})
+	return err
+}
+
 var commands []*Command
 
 func Register(cmd *Command) {
@@ -106,11 +208,13 @@ var (
 )
 
 func RunArgs(arguments []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
-	flag.CommandLine.VisitAll(func(f *flag.Flag) {
-		f.Value.Set(f.DefValue)
-	})
-	flag.CommandLine.Parse(arguments)
-	args := flag.Args()
+	fs := flag.NewFlagSet(AppName, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	globalFlags(fs)
+	if err := fs.Parse(arguments); err != nil {
+		return err
+	}
+	args := fs.Args()
 	if len(args) < 1 {
 		printUsage(os.Stderr)
 		return os.ErrInvalid
@@ -146,7 +250,7 @@ func RunArgs(arguments []string, stdin io.Reader, stdout io.Writer, stderr io.Wr
 				}
 				args = cmd.Flag.Args()
 			}
-			return cmd.Run(cmd, args)
+			return runCommand(cmd, args)
 		}
 	}
 
@@ -195,9 +299,12 @@ func Main() {
 				args = cmd.Flag.Args()
 			}
 			cmd.Flag.Usage = func() { cmd.Usage() }
-			err := cmd.Run(cmd, args)
+			err := runCommand(cmd, args)
 			if err != nil {
-				fmt.Fprintln(cmd.Stderr, err)
+				// the envelope of -json has the error
+				if !jsonMode(cmd) {
+					fmt.Fprintln(cmd.Stderr, err)
+				}
 				Exit(2)
 			}
 			Exit(0)
@@ -216,7 +323,11 @@ var AppName string = "tools"
 var usageTemplate = `
 Usage:
 
-	{{AppName}} command [arguments]
+	{{AppName}} [-json] command [arguments]
+
+The -json flag prints the command results as a json object
+{"command": name, "results": [...], "errors": [...]}. The streaming
+commands serve and lsp write their own responses.
 
 The commands are:
 {{range .}}{{if .Runnable}}
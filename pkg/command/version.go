@@ -5,6 +5,7 @@
 package command
 
 import (
+	"fmt"
 	"os"
 	"runtime"
 )
@@ -28,6 +29,15 @@ func runVersion(cmd *Command, args []string) error {
 		return os.ErrInvalid
 	}
 
-	cmd.Printf("%s version %s [%s %s/%s]\n", AppName, AppVersion, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	cmd.PrintResult(&VersionInfo{AppName, AppVersion, runtime.Version(), runtime.GOOS, runtime.GOARCH},
+		fmt.Sprintf("%s version %s [%s %s/%s]", AppName, AppVersion, runtime.Version(), runtime.GOOS, runtime.GOARCH))
 	return nil
 }
+
+type VersionInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Go      string `json:"go"`
+	GOOS    string `json:"goos"`
+	GOARCH  string `json:"goarch"`
+}
@@ -0,0 +1,267 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	modlist "github.com/visualfc/gomod"
+)
+
+// Workspace is the module graph of a directory: the main modules of its
+// go.mod or go.work file, the required modules and the vendor directory
+// used instead of the module cache.
+type Workspace struct {
+	*modlist.Package
+	Dir      string // directory the workspace is loaded for
+	WorkFile string // go.work file, if any
+	Vendor   string // vendor directory, if imports resolve to vendor
+	vendored map[string]bool
+}
+
+// LoadWorkspace loads the modules of dir with go list. If dir is in vendor
+// mode and the module graph cannot be listed, only the main module and the
+// vendored packages are known.
+func LoadWorkspace(dir string, ctx *build.Context) (*Workspace, error) {
+	ws := &Workspace{Dir: dir, WorkFile: findWorkFile(dir)}
+	modFile := findFile(dir, "go.mod")
+	if modFile == "" && ws.WorkFile == "" {
+		return nil, os.ErrNotExist
+	}
+	if vendor := ws.vendorDir(modFile); vendor != "" {
+		ws.Vendor = vendor
+		ws.vendored = readVendorPackages(filepath.Join(vendor, "modules.txt"))
+	}
+	pkg, err := modlist.Load(dir, ctx)
+	if err != nil {
+		if ws.Vendor == "" || modFile == "" {
+			return nil, err
+		}
+		path := modulePath(modFile)
+		if path == "" {
+			return nil, err
+		}
+		main := &modlist.Module{Path: path, Main: true, Dir: filepath.Dir(modFile), GoMod: modFile}
+		pkg = &modlist.Package{List: []*modlist.Module{main}}
+	}
+	ws.Package = pkg
+	return ws, nil
+}
+
+// Root returns the main module containing the workspace directory.
+func (w *Workspace) Root() *modlist.Module {
+	if m := w.moduleOf(w.Dir, w.MainModules()); m != nil {
+		return m
+	}
+	return w.List[0]
+}
+
+// MainModules returns the modules of go.work, or the module of go.mod.
+func (w *Workspace) MainModules() (list []*modlist.Module) {
+	for _, m := range w.List {
+		if m.Main {
+			list = append(list, m)
+		}
+	}
+	return
+}
+
+// LocalModules returns the main modules and the modules replaced by a
+// local directory.
+func (w *Workspace) LocalModules() (list []*modlist.Module) {
+	for _, m := range w.List {
+		if m.Dir == "" {
+			continue
+		}
+		if m.Main || (m.Replace != nil && m.Replace.Version == "") {
+			list = append(list, m)
+		}
+	}
+	return
+}
+
+// CacheModules returns the required modules found in the module cache.
+func (w *Workspace) CacheModules() (list []*modlist.Module) {
+	for _, m := range w.List {
+		if m.Dir == "" || m.Main || (m.Replace != nil && m.Replace.Version == "") {
+			continue
+		}
+		list = append(list, m)
+	}
+	return
+}
+
+// Lookup returns the import path and directory of the package pkg. The
+// packages of the main modules are found first, then the vendored packages
+// and the packages of the required modules.
+func (w *Workspace) Lookup(pkg string) (path string, dir string, found bool) {
+	if m := w.moduleFor(pkg, w.MainModules()); m != nil {
+		return pkg, filepath.Join(m.Dir, filepath.FromSlash(strings.TrimPrefix(pkg, m.Path))), true
+	}
+	if w.vendored[pkg] {
+		return pkg, filepath.Join(w.Vendor, filepath.FromSlash(pkg)), true
+	}
+	if m := w.moduleFor(pkg, w.List); m != nil && m.Dir != "" {
+		return pkg, filepath.Join(m.Dir, filepath.FromSlash(strings.TrimPrefix(pkg, m.Path))), true
+	}
+	return "", "", false
+}
+
+// ImportPath returns the import path of the package in dir of one of the
+// local modules or the required modules of the module cache.
+func (w *Workspace) ImportPath(dir string) (string, bool) {
+	m := w.moduleOf(dir, w.List)
+	if m == nil {
+		return "", false
+	}
+	if dir == m.Dir {
+		return m.Path, true
+	}
+	return m.Path + "/" + filepath.ToSlash(dir[len(m.Dir)+1:]), true
+}
+
+// moduleFor returns the module of list with the longest path prefix of pkg.
+func (w *Workspace) moduleFor(pkg string, list []*modlist.Module) (found *modlist.Module) {
+	for _, m := range list {
+		if pkg == m.Path || strings.HasPrefix(pkg, m.Path+"/") {
+			if found == nil || len(m.Path) > len(found.Path) {
+				found = m
+			}
+		}
+	}
+	return
+}
+
+// moduleOf returns the module of list with the longest directory containing dir.
+func (w *Workspace) moduleOf(dir string, list []*modlist.Module) (found *modlist.Module) {
+	for _, m := range list {
+		if m.Dir == "" {
+			continue
+		}
+		if dir == m.Dir || strings.HasPrefix(dir, m.Dir+string(filepath.Separator)) {
+			if found == nil || len(m.Dir) > len(found.Dir) {
+				found = m
+			}
+		}
+	}
+	return
+}
+
+// vendorDir returns the vendor directory of the workspace if the go command
+// builds in vendor mode: vendor/modules.txt exists, -mod is not set and the
+// go version of go.mod is at least 1.14.
+func (w *Workspace) vendorDir(modFile string) string {
+	for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if strings.HasPrefix(flag, "-mod=") || strings.HasPrefix(flag, "--mod=") {
+			if !strings.HasSuffix(flag, "=vendor") {
+				return ""
+			}
+		}
+	}
+	var root string
+	if w.WorkFile != "" {
+		root = filepath.Dir(w.WorkFile)
+	} else {
+		if !atLeastGo114(modFile) {
+			return ""
+		}
+		root = filepath.Dir(modFile)
+	}
+	vendor := filepath.Join(root, "vendor")
+	if _, err := os.Stat(filepath.Join(vendor, "modules.txt")); err != nil {
+		return ""
+	}
+	return vendor
+}
+
+// findWorkFile returns the go.work file of dir from the GOWORK environment
+// or the parent directories of dir.
+func findWorkFile(dir string) string {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "":
+		return findFile(dir, "go.work")
+	default:
+		return gowork
+	}
+}
+
+// findFile returns the file name in dir or the nearest parent directory.
+func findFile(dir string, name string) string {
+	for {
+		file := filepath.Join(dir, name)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func modulePath(modFile string) string {
+	data, err := ioutil.ReadFile(modFile)
+	if err != nil {
+		return ""
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) >= 2 && fields[0] == "module" {
+			if path, err := strconv.Unquote(fields[1]); err == nil {
+				return path
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+func atLeastGo114(modFile string) bool {
+	data, err := ioutil.ReadFile(modFile)
+	if err != nil {
+		return false
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) >= 2 && fields[0] == "go" {
+			parts := strings.SplitN(fields[1], ".", 3)
+			if len(parts) < 2 {
+				return false
+			}
+			major, _ := strconv.Atoi(parts[0])
+			minor, _ := strconv.Atoi(parts[1])
+			return major > 1 || (major == 1 && minor >= 14)
+		}
+	}
+	return false
+}
+
+// readVendorPackages returns the packages listed in vendor/modules.txt.
+func readVendorPackages(filename string) map[string]bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	pkgs := make(map[string]bool)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			pkgs[line] = true
+		}
+	}
+	return pkgs
+}
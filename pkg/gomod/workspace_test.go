@@ -0,0 +1,191 @@
+package gomod
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	modlist "github.com/visualfc/gomod"
+)
+
+// setenv sets the environment variable key to value and returns the function
+// restoring it.
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gomod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the go command reports the directories with symbolic links evaluated
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func modulePaths(list []*modlist.Module) string {
+	var paths []string
+	for _, m := range list {
+		paths = append(paths, m.Path)
+	}
+	return strings.Join(paths, " ")
+}
+
+func TestWorkspace(t *testing.T) {
+	defer setenv("GOFLAGS", "")()
+	defer setenv("GOWORK", "")()
+	defer setenv("GOPROXY", "off")()
+	dir := writeFiles(t, map[string]string{
+		"go.work":      "go 1.18\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod":     "module example.com/a\n\ngo 1.18\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ../dep\n",
+		"a/sub/sub.go": "package sub\n",
+		"b/go.mod":     "module example.com/b\n\ngo 1.18\n",
+		"b/b.go":       "package b\n",
+		"dep/go.mod":   "module example.com/dep\n\ngo 1.18\n",
+		"dep/dep.go":   "package dep\n",
+	})
+	defer os.RemoveAll(dir)
+	ws, err := LoadWorkspace(filepath.Join(dir, "a", "sub"), &build.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.WorkFile != filepath.Join(dir, "go.work") || ws.Vendor != "" {
+		t.Fatalf("got work file %q and vendor %q", ws.WorkFile, ws.Vendor)
+	}
+	if got := ws.Root().Path; got != "example.com/a" {
+		t.Fatalf("got root %v", got)
+	}
+	for _, test := range []struct {
+		name string
+		list []*modlist.Module
+		want string
+	}{
+		{"MainModules", ws.MainModules(), "example.com/a example.com/b"},
+		{"LocalModules", ws.LocalModules(), "example.com/a example.com/b example.com/dep"},
+		{"CacheModules", ws.CacheModules(), ""},
+	} {
+		if got := modulePaths(test.list); got != test.want {
+			t.Errorf("%v: got %q want %q", test.name, got, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		pkg   string
+		dir   string
+		found bool
+	}{
+		{"example.com/a/sub", "a/sub", true},
+		{"example.com/b", "b", true},
+		{"example.com/dep/x", "dep/x", true},
+		{"example.com/other", "", false},
+	} {
+		path, pkgDir, found := ws.Lookup(test.pkg)
+		want := ""
+		if test.found {
+			want = filepath.Join(dir, filepath.FromSlash(test.dir))
+		}
+		if found != test.found || found && (path != test.pkg || pkgDir != want) {
+			t.Errorf("Lookup %v: got %q %q %v", test.pkg, path, pkgDir, found)
+		}
+	}
+
+	for _, test := range []struct {
+		dir  string
+		path string
+		ok   bool
+	}{
+		{"a", "example.com/a", true},
+		{"a/sub", "example.com/a/sub", true},
+		{"b/c/d", "example.com/b/c/d", true},
+		{"dep", "example.com/dep", true},
+		{".", "", false},
+	} {
+		path, ok := ws.ImportPath(filepath.Join(dir, filepath.FromSlash(test.dir)))
+		if path != test.path || ok != test.ok {
+			t.Errorf("ImportPath %v: got %q %v want %q %v", test.dir, path, ok, test.path, test.ok)
+		}
+	}
+}
+
+func TestVendorWorkspace(t *testing.T) {
+	defer setenv("GOFLAGS", "")()
+	defer setenv("GOWORK", "off")()
+	defer setenv("GOPROXY", "off")()
+	dir := writeFiles(t, map[string]string{
+		"go.mod":                          "module example.com/v\n\ngo 1.14\n\nrequire example.com/vend v1.0.0\n",
+		"v.go":                            "package v\n",
+		"vendor/modules.txt":              "# example.com/vend v1.0.0\n## explicit\nexample.com/vend\nexample.com/vend/sub\n",
+		"vendor/example.com/vend/vend.go": "package vend\n",
+		"old/go.mod":                      "module example.com/old\n\ngo 1.13\n",
+		"old/vendor/modules.txt":          "# example.com/vend v1.0.0\nexample.com/vend\n",
+	})
+	defer os.RemoveAll(dir)
+	vendor := filepath.Join(dir, "vendor")
+
+	// the module graph cannot be listed without the module cache, only the
+	// main module and the vendored packages are known
+	ws, err := LoadWorkspace(dir, &build.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Vendor != vendor {
+		t.Fatalf("got vendor %q want %q", ws.Vendor, vendor)
+	}
+	for _, test := range []struct {
+		pkg   string
+		dir   string
+		found bool
+	}{
+		{"example.com/v/x", "x", true},
+		{"example.com/vend", "vendor/example.com/vend", true},
+		{"example.com/vend/sub", "vendor/example.com/vend/sub", true},
+		{"example.com/vend/other", "", false},
+	} {
+		path, pkgDir, found := ws.Lookup(test.pkg)
+		want := ""
+		if test.found {
+			want = filepath.Join(dir, filepath.FromSlash(test.dir))
+		}
+		if found != test.found || found && (path != test.pkg || pkgDir != want) {
+			t.Errorf("Lookup %v: got %q %q %v", test.pkg, path, pkgDir, found)
+		}
+	}
+
+	for _, test := range []struct {
+		goflags string
+		modFile string
+		want    string
+	}{
+		{"", "go.mod", vendor},
+		{"-mod=vendor", "go.mod", vendor},
+		{"-mod=mod", "go.mod", ""},
+		{"", "old/go.mod", ""},
+	} {
+		os.Setenv("GOFLAGS", test.goflags)
+		if got := (&Workspace{}).vendorDir(filepath.Join(dir, filepath.FromSlash(test.modFile))); got != test.want {
+			t.Errorf("vendorDir %q %v: got %q want %q", test.goflags, test.modFile, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pkgcache stores the export data of type-checked packages in a
+// directory, keyed by a hash of everything the package was checked from.
+package pkgcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnvName is the environment variable holding the cache directory. The cache
+// is disabled if it is not set.
+const EnvName = "GOTOOLS_CACHE"
+
+// version is part of every key, change it if the stored data changes.
+const version = "gotools export v1"
+
+const suffix = "-x"
+
+// Cache is a directory of export data files.
+type Cache struct {
+	Dir string
+}
+
+// Default returns the cache of the GOTOOLS_CACHE directory, or nil if it
+// is not set.
+func Default() *Cache {
+	dir, ok := os.LookupEnv(EnvName)
+	if !ok || dir == "" {
+		return nil
+	}
+	return &Cache{Dir: dir}
+}
+
+// Key is a hash of the inputs of a cache entry.
+type Key struct {
+	h hash.Hash
+}
+
+func NewKey() *Key {
+	k := &Key{sha256.New()}
+	k.Add(version)
+	return k
+}
+
+// Add adds the strings to the key. Each string is terminated so adjacent
+// strings do not run together.
+func (k *Key) Add(list ...string) {
+	for _, s := range list {
+		fmt.Fprintf(k.h, "%d:%s\n", len(s), s)
+	}
+}
+
+// AddData adds the hash of data to the key.
+func (k *Key) AddData(data []byte) {
+	sum := sha256.Sum256(data)
+	k.Add(hex.EncodeToString(sum[:]))
+}
+
+func (k *Key) String() string {
+	return hex.EncodeToString(k.h.Sum(nil))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+suffix)
+}
+
+// Get returns the data stored for key.
+func (c *Cache) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err == nil {
+		now := time.Now()
+		os.Chtimes(c.path(key), now, now)
+	}
+	return data, err
+}
+
+// Has reports whether data is stored for key.
+func (c *Cache) Has(key string) bool {
+	_, err := os.Stat(c.path(key))
+	return err == nil
+}
+
+// Put stores data for key. The file is written to a temporary file first
+// so concurrent readers never see partial data.
+func (c *Cache) Put(key string, data []byte) error {
+	filename := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Clean removes all entries of the cache.
+func (c *Cache) Clean() error {
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && len(e.Name()) == 2 {
+			if err := os.RemoveAll(filepath.Join(c.Dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stats is the number of entries and their size in bytes.
+type Stats struct {
+	Dir     string    `json:"dir"`
+	Entries int       `json:"entries"`
+	Size    int64     `json:"size"`
+	Oldest  time.Time `json:"oldest,omitempty"`
+	Newest  time.Time `json:"newest,omitempty"`
+}
+
+func (s *Stats) String() string {
+	text := fmt.Sprintf("dir: %v\nentries: %v\nsize: %v", s.Dir, s.Entries, s.Size)
+	if s.Entries > 0 {
+		text += fmt.Sprintf("\noldest: %v\nnewest: %v", s.Oldest.Format(time.RFC3339), s.Newest.Format(time.RFC3339))
+	}
+	return text
+}
+
+// Stats returns the statistics of the cache entries.
+func (c *Cache) Stats() (*Stats, error) {
+	s := &Stats{Dir: c.Dir}
+	err := filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, suffix) {
+			return nil
+		}
+		s.Entries++
+		s.Size += info.Size()
+		if t := info.ModTime(); s.Oldest.IsZero() || t.Before(s.Oldest) {
+			s.Oldest = t
+		}
+		if t := info.ModTime(); t.After(s.Newest) {
+			s.Newest = t
+		}
+		return nil
+	})
+	return s, err
+}
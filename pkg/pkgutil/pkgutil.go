@@ -238,3 +238,44 @@ func VendorPathToImportPath(path string) string {
 	}
 	return path
 }
+
+// ExpandPattern returns the package of arg, made absolute if it is a
+// directory, or the directories below arg containing Go files if arg ends
+// in /... .
+func ExpandPattern(arg string) ([]string, error) {
+	if !strings.HasSuffix(arg, "/...") {
+		if build.IsLocalImport(arg) || filepath.IsAbs(arg) {
+			return []string{absDir(arg)}, nil
+		}
+		return []string{arg}, nil
+	}
+	root := absDir(strings.TrimSuffix(arg, "/..."))
+	var pkgs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") {
+			dir := filepath.Dir(path)
+			if len(pkgs) == 0 || pkgs[len(pkgs)-1] != dir {
+				pkgs = append(pkgs, dir)
+			}
+		}
+		return nil
+	})
+	return pkgs, err
+}
+
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/visualfc/gotools/pkg/pkgutil"
 	"github.com/visualfc/gotools/pkg/stdlib"
+	"github.com/visualfc/gotools/pkg/typeparams"
 )
 
 var (
@@ -60,13 +61,16 @@ const (
 	ObjImplicit
 	ObjUnknown
 	ObjComment
+	ObjTypeParam
+	ObjConstraint
 )
 
 var ObjKindName = []string{"none", "package", "packagex", "import",
 	"type", "interface", "struct",
 	"const", "var", "field",
 	"func", "method",
-	"label", "builtin", "nil", "implicit", "unknown"}
+	"label", "builtin", "nil", "implicit", "unknown", "comment",
+	"typeparam", "constraint"}
 
 func (k ObjKind) String() string {
 	if k >= 0 && int(k) < len(ObjKindName) {
@@ -134,20 +138,8 @@ func simpleType(src string) string {
 func DefaultPkgConfig() *PkgConfig {
 	conf := &PkgConfig{IgnoreFuncBodies: true, AllowBinary: true, WithTestFiles: true}
 	conf.IgnoreFuncBodies = false
-	conf.Info = &types.Info{
-		Uses:       make(map[*ast.Ident]types.Object),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Scopes:     make(map[ast.Node]*types.Scope),
-		Implicits:  make(map[ast.Node]types.Object),
-	}
-	conf.XInfo = &types.Info{
-		Uses:       make(map[*ast.Ident]types.Object),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Implicits:  make(map[ast.Node]types.Object),
-	}
+	conf.Info = newInfo()
+	conf.XInfo = newInfo()
 	return conf
 }
 
@@ -705,6 +697,11 @@ func parserObjKind(obj types.Object) (ObjKind, error) {
 		case *types.Struct:
 			kind = ObjStruct
 		}
+		if typeparams.IsTypeParam(t) {
+			kind = ObjTypeParam
+		} else if typeparams.IsConstraint(t) {
+			kind = ObjConstraint
+		}
 	case *types.Var:
 		kind = ObjVar
 		if t.IsField() {
@@ -851,7 +848,7 @@ func IsSameObject(a, b types.Object) bool {
 	if a.Id() != b.Id() {
 		return false
 	}
-	return a.String() == b.String()
+	return a.String() == b.String() || sameOrigin(a, b)
 }
 
 func orgType(typ types.Type) types.Type {
@@ -1044,6 +1041,15 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) {
 		} else {
 			fmt.Println(simpleObjInfo(cursorObj))
 		}
+		qualifier := func(p *types.Package) string {
+			if p == pkg {
+				return ""
+			}
+			return p.Name()
+		}
+		if info := typeparams.Instance(pkgInfo, cursorObj, cursor.pos, qualifier); info != "" {
+			fmt.Println(info)
+		}
 	}
 
 	if typesFindDoc && typesFindDef {
@@ -1085,7 +1091,7 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) {
 		//			}
 		//		}
 		for id, obj := range pkgInfo.Uses {
-			if obj == cursorObj { //!= nil && cursorObj.Pos() == obj.Pos() {
+			if obj == cursorObj || (obj != nil && sameOrigin(obj, cursorObj)) {
 				usages = append(usages, int(id.Pos()))
 			}
 		}
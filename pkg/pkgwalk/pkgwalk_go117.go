@@ -0,0 +1,24 @@
+//go:build !go1.18
+// +build !go1.18
+
+package pkgwalk
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+func newInfo() *types.Info {
+	return &types.Info{
+		Uses:       make(map[*ast.Ident]types.Object),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Scopes:     make(map[ast.Node]*types.Scope),
+		Implicits:  make(map[ast.Node]types.Object),
+	}
+}
+
+func sameOrigin(a, b types.Object) bool {
+	return false
+}
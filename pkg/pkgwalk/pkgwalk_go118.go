@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package pkgwalk
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+func newInfo() *types.Info {
+	return &types.Info{
+		Uses:       make(map[*ast.Ident]types.Object),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Scopes:     make(map[ast.Node]*types.Scope),
+		Implicits:  make(map[ast.Node]types.Object),
+		Instances:  make(map[*ast.Ident]types.Instance),
+	}
+}
+
+// sameOrigin reports whether a and b are the same method of different
+// instantiations of a generic type, as List[int].Push and List[string].Push.
+func sameOrigin(a, b types.Object) bool {
+	n1, ok1 := recvNamed(a)
+	n2, ok2 := recvNamed(b)
+	return ok1 && ok2 && a.Name() == b.Name() && IsSameObject(n1.Origin().Obj(), n2.Origin().Obj())
+}
+
+func recvNamed(obj types.Object) (*types.Named, bool) {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil, false
+	}
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return nil, false
+	}
+	named, ok := orgType(sig.Recv().Type()).(*types.Named)
+	return named, ok
+}
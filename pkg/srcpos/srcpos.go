@@ -0,0 +1,277 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package srcpos converts source positions between the byte offsets of
+// go/token and the offsets and line:column positions of editors, which
+// count bytes, runes or UTF-16 code units.
+package srcpos
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encoding is the unit offsets and columns count.
+type Encoding int
+
+const (
+	Byte  Encoding = iota // UTF-8 bytes, as go/token
+	Rune                  // Unicode code points
+	UTF16                 // UTF-16 code units, as LSP by default
+)
+
+// ParseEncoding returns the encoding named byte (utf-8), rune (utf-32) or
+// utf16 (utf-16).
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(name) {
+	case "", "byte", "utf8", "utf-8":
+		return Byte, nil
+	case "rune", "utf32", "utf-32":
+		return Rune, nil
+	case "utf16", "utf-16":
+		return UTF16, nil
+	}
+	return Byte, fmt.Errorf("invalid position encoding %q (byte, rune or utf16)", name)
+}
+
+func (e Encoding) String() string {
+	switch e {
+	case Rune:
+		return "rune"
+	case UTF16:
+		return "utf16"
+	}
+	return "byte"
+}
+
+// Pos is a cursor position in a file: an offset, or a 1-based line and
+// column if Line > 0.
+type Pos struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// ParsePos parses a cursor position "file.go:offset" or "file.go:line:column".
+// Lines and columns start at 1.
+func ParsePos(s string) (Pos, error) {
+	i := strings.LastIndex(s, ":")
+	if i == -1 {
+		return Pos{}, fmt.Errorf("invalid position %q", s)
+	}
+	n, err := strconv.Atoi(s[i+1:])
+	if err != nil || n < 0 {
+		return Pos{}, fmt.Errorf("invalid position %q", s)
+	}
+	if j := strings.LastIndex(s[:i], ":"); j != -1 {
+		if line, err := strconv.Atoi(s[j+1 : i]); err == nil {
+			if line < 1 || n < 1 {
+				return Pos{}, fmt.Errorf("invalid position %q: line and column start at 1", s)
+			}
+			return Pos{Filename: s[:j], Line: line, Column: n}, nil
+		}
+	}
+	return Pos{Filename: s[:i], Offset: n}, nil
+}
+
+// ByteOffset returns the byte offset of the cursor p in src, where the
+// offset or column of p counts units of e.
+func (p Pos) ByteOffset(src []byte, e Encoding) int {
+	if p.Line > 0 {
+		start := lineStart(src, p.Line)
+		return start + byteCount(src[start:], p.Column-1, e, true)
+	}
+	return byteCount(src, p.Offset, e, false)
+}
+
+// Count returns the length of b in units of e.
+func Count(b []byte, e Encoding) int {
+	switch e {
+	case Rune:
+		return utf8.RuneCount(b)
+	case UTF16:
+		n := 0
+		for len(b) > 0 {
+			r, size := utf8.DecodeRune(b)
+			if r >= 0x10000 {
+				n++
+			}
+			n++
+			b = b[size:]
+		}
+		return n
+	}
+	return len(b)
+}
+
+// byteCount returns the number of bytes of the first n units of e in src,
+// stopping at the end of the line if eol is set.
+func byteCount(src []byte, n int, e Encoding, eol bool) int {
+	if e == Byte {
+		if n > len(src) {
+			n = len(src)
+		}
+		if eol {
+			if i := bytes.IndexByte(src[:n], '\n'); i != -1 {
+				return i
+			}
+		}
+		return n
+	}
+	off := 0
+	for n > 0 && off < len(src) {
+		r, size := utf8.DecodeRune(src[off:])
+		if eol && r == '\n' {
+			break
+		}
+		n--
+		if e == UTF16 && r >= 0x10000 {
+			n--
+		}
+		off += size
+	}
+	return off
+}
+
+func lineStart(src []byte, line int) int {
+	off := 0
+	for line > 1 {
+		i := bytes.IndexByte(src[off:], '\n')
+		if i == -1 {
+			return len(src)
+		}
+		off += i + 1
+		line--
+	}
+	return off
+}
+
+// TokenLen returns the length in bytes of the Go token at the byte offset
+// of src, or 0 if there is none.
+func TokenLen(src []byte, offset int) int {
+	if offset < 0 || offset >= len(src) {
+		return 0
+	}
+	src = src[offset:]
+	tf := token.NewFileSet().AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(tf, src, nil, scanner.ScanComments)
+	pos, tok, lit := s.Scan()
+	if tok == token.EOF || tok == token.ILLEGAL || tf.Offset(pos) != 0 {
+		return 0
+	}
+	if lit == "" || tok == token.SEMICOLON {
+		lit = tok.String()
+	}
+	return len(lit)
+}
+
+// Converter converts byte positions of go/token to positions counting
+// units of its encoding. Files are read once.
+type Converter struct {
+	Encoding Encoding
+	ReadFile func(filename string) ([]byte, error)
+	files    map[string]*file
+}
+
+type file struct {
+	src   []byte
+	lines []int
+}
+
+func (c *Converter) file(filename string) *file {
+	if f, ok := c.files[filename]; ok {
+		return f
+	}
+	if c.files == nil {
+		c.files = make(map[string]*file)
+	}
+	src, err := c.ReadFile(filename)
+	if err != nil {
+		c.files[filename] = nil
+		return nil
+	}
+	f := &file{src: src, lines: []int{0}}
+	for i, b := range src {
+		if b == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+	c.files[filename] = f
+	return f
+}
+
+// offset returns the byte offset of the line and column of pos. The
+// offset of pos is not used, positions of export data have none.
+func (f *file) offset(pos token.Position) (int, bool) {
+	if pos.Line < 1 || pos.Line > len(f.lines) {
+		return 0, false
+	}
+	off := f.lines[pos.Line-1] + pos.Column - 1
+	if off < 0 || off > len(f.src) {
+		return 0, false
+	}
+	return off, true
+}
+
+// Position returns pos with its column and offset counting units of the
+// encoding.
+func (c *Converter) Position(pos token.Position) token.Position {
+	if c == nil || c.Encoding == Byte || !pos.IsValid() {
+		return pos
+	}
+	f := c.file(pos.Filename)
+	if f == nil {
+		return pos
+	}
+	off, ok := f.offset(pos)
+	if !ok {
+		return pos
+	}
+	start := f.lines[pos.Line-1]
+	pos.Column = Count(f.src[start:off], c.Encoding) + 1
+	pos.Offset = Count(f.src[:off], c.Encoding)
+	return pos
+}
+
+// End returns the byte position of the end of the Go token at pos, or an
+// invalid position if there is none.
+func (c *Converter) End(pos token.Position) token.Position {
+	if c == nil || !pos.IsValid() {
+		return token.Position{}
+	}
+	f := c.file(pos.Filename)
+	if f == nil {
+		return token.Position{}
+	}
+	off, ok := f.offset(pos)
+	if !ok {
+		return token.Position{}
+	}
+	n := TokenLen(f.src, off)
+	if n == 0 {
+		return token.Position{}
+	}
+	end := pos
+	end.Offset = off + n
+	for _, b := range f.src[off : off+n] {
+		if b == '\n' {
+			end.Line++
+		}
+	}
+	end.Column = off + n - f.lines[end.Line-1] + 1
+	return end
+}
+
+// Range returns the positions of the start and end of the Go token at pos
+// counting units of the encoding.
+func (c *Converter) Range(pos token.Position) (token.Position, token.Position) {
+	return c.Position(pos), c.Position(c.End(pos))
+}
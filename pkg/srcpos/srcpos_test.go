@@ -0,0 +1,28 @@
+package srcpos
+
+import "testing"
+
+func TestParsePos(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want Pos
+		ok   bool
+	}{
+		{"a.go:12", Pos{Filename: "a.go", Offset: 12}, true},
+		{"a.go:0", Pos{Filename: "a.go"}, true},
+		{"a.go:3:5", Pos{Filename: "a.go", Line: 3, Column: 5}, true},
+		{`C:\src\a.go:3:5`, Pos{Filename: `C:\src\a.go`, Line: 3, Column: 5}, true},
+		{`C:\src\a.go:12`, Pos{Filename: `C:\src\a.go`, Offset: 12}, true},
+		{"a.go:3:0", Pos{}, false},
+		{"a.go:0:5", Pos{}, false},
+		{"a.go:-1:5", Pos{}, false},
+		{"a.go:-1", Pos{}, false},
+		{"a.go:x", Pos{}, false},
+		{"a.go", Pos{}, false},
+	} {
+		got, err := ParsePos(test.s)
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("%v: got %+v %v", test.s, got, err)
+		}
+	}
+}
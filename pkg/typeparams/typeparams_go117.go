@@ -0,0 +1,26 @@
+//go:build !go1.18
+// +build !go1.18
+
+package typeparams
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+func IsTypeParam(obj *types.TypeName) bool {
+	return false
+}
+
+func IsConstraint(obj *types.TypeName) bool {
+	return false
+}
+
+func TypeArgs(info *types.Info, id *ast.Ident, q types.Qualifier) string {
+	return ""
+}
+
+func Instance(info *types.Info, obj types.Object, pos token.Pos, q types.Qualifier) string {
+	return ""
+}
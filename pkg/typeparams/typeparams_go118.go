@@ -0,0 +1,86 @@
+//go:build go1.18
+// +build go1.18
+
+// Package typeparams describes type parameters and the instances of generic
+// functions and types, it has no results before go1.18.
+package typeparams
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// IsTypeParam reports whether obj is a type parameter.
+func IsTypeParam(obj *types.TypeName) bool {
+	_, ok := obj.Type().(*types.TypeParam)
+	return ok
+}
+
+// IsConstraint reports whether obj is a constraint, an interface with a
+// type set that can only constrain type parameters.
+func IsConstraint(obj *types.TypeName) bool {
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	return ok && !iface.IsMethodSet()
+}
+
+// TypeArgs returns the type arguments of the generic function or type id
+// inferred or given at its use, as [T int, U string], or "".
+func TypeArgs(info *types.Info, id *ast.Ident, q types.Qualifier) string {
+	inst, ok := info.Instances[id]
+	if !ok || inst.TypeArgs.Len() == 0 {
+		return ""
+	}
+	var tparams *types.TypeParamList
+	switch obj := info.Uses[id].(type) {
+	case *types.Func:
+		tparams = obj.Type().(*types.Signature).TypeParams()
+	case *types.TypeName:
+		if named, ok := obj.Type().(*types.Named); ok {
+			tparams = named.TypeParams()
+		}
+	}
+	var list []string
+	for i := 0; i < inst.TypeArgs.Len(); i++ {
+		arg := types.TypeString(inst.TypeArgs.At(i), q)
+		if tparams != nil && i < tparams.Len() {
+			arg = tparams.At(i).Obj().Name() + " " + arg
+		}
+		list = append(list, arg)
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+// Instance returns the instance of the generic function or type obj at the
+// identifier containing pos with the type arguments inferred or given there,
+// as func Map[T int, U string](s []int, f func(int) string) []string, or ""
+// if obj is not instantiated at pos.
+func Instance(info *types.Info, obj types.Object, pos token.Pos, q types.Qualifier) string {
+	if obj == nil {
+		return ""
+	}
+	for id, inst := range info.Instances {
+		if pos < id.Pos() || pos > id.End() || info.Uses[id] != obj {
+			continue
+		}
+		var buf bytes.Buffer
+		name := obj.Name()
+		if obj.Pkg() != nil && q(obj.Pkg()) != "" {
+			name = q(obj.Pkg()) + "." + name
+		}
+		switch typ := inst.Type.(type) {
+		case *types.Signature:
+			buf.WriteString("func " + name + TypeArgs(info, id, q))
+			types.WriteSignature(&buf, typ, q)
+		case *types.Named:
+			buf.WriteString("type " + name + TypeArgs(info, id, q) + " ")
+			types.WriteType(&buf, typ.Underlying(), q)
+		default:
+			return ""
+		}
+		return buf.String()
+	}
+	return ""
+}
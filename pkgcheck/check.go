@@ -5,9 +5,10 @@ import (
 	"go/build"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/visualfc/gomod"
 	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/gomod"
 	"github.com/visualfc/gotools/pkg/pkgutil"
 )
 
@@ -38,21 +39,25 @@ func runCheck(cmd *command.Command, args []string) error {
 	if flagCheckDir == "" || flagCheckDir == "." {
 		flagCheckDir, _ = os.Getwd()
 	}
-	mod, _ := gomod.Load(flagCheckDir, &build.Default)
+	mod, _ := gomod.LoadWorkspace(flagCheckDir, &build.Default)
 	if flagCheckName {
 		if mod != nil {
-			fmt.Println(mod.Root().Path)
+			cmd.PrintResult(&Result{Name: mod.Root().Path}, mod.Root().Path)
 		} else {
 			_, fname := filepath.Split(flagCheckDir)
-			fmt.Println(fname)
+			cmd.PrintResult(&Result{Name: fname}, fname)
 		}
 		return nil
 	}
 	// check mod, check vendor
 	if mod != nil {
 		_, dir, _ := mod.Lookup(flagCheckPkg)
+		if dir != "" && mod.Vendor != "" && strings.HasPrefix(dir, mod.Vendor+string(filepath.Separator)) {
+			cmd.PrintResult(&Result{Path: dir, Kind: "vendor"}, fmt.Sprintf("%s,vendor", dir))
+			return nil
+		}
 		if dir != "" {
-			fmt.Printf("%s,mod\n", dir)
+			cmd.PrintResult(&Result{Path: dir, Kind: "mod"}, fmt.Sprintf("%s,mod", dir))
 			return nil
 		}
 	} else {
@@ -60,11 +65,18 @@ func runCheck(cmd *command.Command, args []string) error {
 		if pkg != nil {
 			found, _ := pkgutil.VendoredImportPath(pkg, flagCheckPkg)
 			if found != "" && found != flagCheckPkg {
-				fmt.Printf("%s,vendor\n", found)
+				cmd.PrintResult(&Result{Path: found, Kind: "vendor"}, fmt.Sprintf("%s,vendor", found))
 				return nil
 			}
 		}
 	}
-	fmt.Printf("%s,pkg\n", flagCheckPkg)
+	cmd.PrintResult(&Result{Path: flagCheckPkg, Kind: "pkg"}, fmt.Sprintf("%s,pkg", flagCheckPkg))
 	return nil
 }
+
+// Result is the json output of pkgcheck. Kind is one of mod, vendor or pkg.
+type Result struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+	Kind string `json:"kind,omitempty"`
+}
@@ -64,7 +64,11 @@ func runPkgs(cmd *command.Command, args []string) error {
 	pp.LoadIndex(build.Default, flag)
 	pp.Sort()
 	export := func(pkg *build.Package) {
-		if pkgsJson {
+		if cmd.JSON() {
+			var p GoPackage
+			p.copyBuild(pkg)
+			cmd.PrintResult(&p, "")
+		} else if pkgsJson {
 			var p GoPackage
 			p.copyBuild(pkg)
 			b, err := json.MarshalIndent(&p, "", "\t")
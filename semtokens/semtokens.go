@@ -0,0 +1,83 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semtokens
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runSemTokens,
+	UsageLine: "semtokens [-stdin] [-posenc byte|rune|utf16] [-tags tags] file.go",
+	Short:     "print semantic tokens for syntax highlighting",
+	Long: `Semtokens type-checks the package of the file and prints the identifiers of
+the file in source order, one per line as line:column-endcolumn type
+modifiers.
+
+The types are the LSP semantic token types namespace, type, interface,
+struct, typeParameter, parameter, variable, property, function, method and
+label. The modifiers are definition, readonly for consts, deprecated and
+defaultLibrary for the standard library.`,
+}
+
+var (
+	semTokensStdin   bool
+	semTokensPosEnc  string
+	semTokensTags    string
+	semTokensOverlay string
+)
+
+func init() {
+	Command.Flag.BoolVar(&semTokensStdin, "stdin", false, "input file use stdin")
+	Command.Flag.StringVar(&semTokensPosEnc, "posenc", "byte", "encoding of columns and lengths: byte, rune or utf16")
+	Command.Flag.StringVar(&semTokensTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.StringVar(&semTokensOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
+}
+
+func runSemTokens(cmd *command.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	enc, err := srcpos.ParseEncoding(semTokensPosEnc)
+	if err != nil {
+		return err
+	}
+	filename, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	r := &types.Request{Tags: semTokensTags, Overlay: semTokensOverlay, Stdin: semTokensStdin}
+	defer r.Close()
+	w, err := r.Walker(cmd, filename)
+	if err != nil {
+		return err
+	}
+	w.PosEncoding = enc
+	cursor := r.Cursor(filename, 0)
+	pkg, conf, err := r.Check(filepath.Dir(filename), cursor)
+	if pkg == nil {
+		return fmt.Errorf("error import path %v", err)
+	}
+	list, err := w.LookupSemanticTokens(conf, cursor)
+	if err != nil {
+		return err
+	}
+	for _, t := range list {
+		text := fmt.Sprintf("%d:%d-%d %s", t.Line, t.Column, t.Column+t.Length, t.Type)
+		if len(t.Modifiers) > 0 {
+			text += " " + strings.Join(t.Modifiers, ",")
+		}
+		cmd.PrintResult(t, text)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/symbols"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runServe,
+	UsageLine: "serve [-socket path]",
+	Short:     "serve commands with warm caches",
+	Long: `Serve reads requests and runs the registered commands in one long-running process,
+so the type checker caches are kept between requests.
+
+Each request is one JSON object per line:
+	{"id":1,"args":["types","-pos","main.go:120","-def","."],"stdin":""}
+
+Each response is one JSON object per line:
+	{"id":1,"stdout":"...","stderr":"...","error":""}
+
+The args "invalidate" drop the cached data of the request files, or all caches
+if no files are given. The args "exit" stop the server.`,
+	Streaming: true,
+}
+
+var (
+	serveSocket string
+)
+
+func init() {
+	Command.Flag.StringVar(&serveSocket, "socket", "", "listen on unix socket path instead of stdin")
+}
+
+type Request struct {
+	ID    int      `json:"id"`
+	Args  []string `json:"args"`
+	Stdin string   `json:"stdin,omitempty"`
+	Files []string `json:"files,omitempty"`
+}
+
+type Response struct {
+	ID     int    `json:"id"`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+	Error  string `json:"error,omitempty"`
+}
+
+var errExit = fmt.Errorf("exit")
+
+// Server dispatches requests through the registered commands.
+// Requests are run one at a time, commands keep their flags in globals.
+type Server struct {
+	mu sync.Mutex
+}
+
+func NewServer() *Server {
+	types.EnableWalkerCache(true)
+	return &Server{}
+}
+
+func runServe(cmd *command.Command, args []string) error {
+	if len(args) != 0 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	s := NewServer()
+	if serveSocket == "" {
+		err := s.Serve(cmd.Stdin, cmd.Stdout)
+		if err == errExit {
+			return nil
+		}
+		return err
+	}
+	os.Remove(serveSocket)
+	ln, err := net.Listen("unix", serveSocket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(serveSocket)
+	return s.Listen(ln)
+}
+
+// Listen accepts connections on ln and serves each of them until a
+// client sends the exit request.
+func (s *Server) Listen(ln net.Listener) error {
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		<-done
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go func() {
+			defer conn.Close()
+			if s.Serve(conn, conn) == errExit {
+				once.Do(func() { close(done) })
+			}
+		}()
+	}
+}
+
+// Serve reads requests from r and writes responses to w until r is closed
+// or the exit request is received.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	enc := json.NewEncoder(w)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var req Request
+			var resp *Response
+			if e := json.Unmarshal(line, &req); e != nil {
+				resp = &Response{Error: e.Error()}
+			} else {
+				resp = s.Do(&req)
+			}
+			if e := enc.Encode(resp); e != nil {
+				return e
+			}
+			if resp.Error == errExit.Error() {
+				return errExit
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Do runs one request.
+func (s *Server) Do(req *Request) (resp *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp = &Response{ID: req.ID}
+	if len(req.Args) == 0 {
+		resp.Error = os.ErrInvalid.Error()
+		return
+	}
+	switch req.Args[0] {
+	case "exit":
+		resp.Error = errExit.Error()
+		return
+	case "invalidate":
+		types.InvalidateCache(req.Files...)
+		symbols.DefaultIndex.Invalidate(req.Files...)
+		return
+	case "serve":
+		resp.Error = "serve cannot run itself"
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	defer func() {
+		if r := recover(); r != nil {
+			resp.Error = fmt.Sprint(r)
+		}
+		resp.Stdout = stdout.String()
+		resp.Stderr = stderr.String()
+	}()
+	err := command.RunArgs(req.Args, strings.NewReader(req.Stdin), &stdout, &stderr)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return
+}
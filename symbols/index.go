@@ -0,0 +1,230 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package symbols
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/visualfc/gotools/astview"
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/gomod"
+)
+
+// Root is a source tree indexed for symbols. The package of a directory
+// below Dir has the import path Path joined with the relative directory.
+type Root struct {
+	Dir  string
+	Path string
+}
+
+// Symbol is a symbol of the index with its package and file.
+type Symbol struct {
+	*astview.Symbol
+	Package  string `json:"package"`
+	Filename string `json:"filename"`
+}
+
+// Index holds the symbols of the files of source trees. The symbols of a
+// file are parsed again only when its size or modification time changes.
+// The directories of a tree are walked once, Invalidate drops them if a
+// file of a new directory is invalidated.
+type Index struct {
+	mu    sync.Mutex
+	files map[string]*fileEntry
+	roots map[string][]Root
+	dirs  map[Root]map[string]bool
+}
+
+type fileEntry struct {
+	size    int64
+	modTime time.Time
+	symbols []*astview.Symbol
+}
+
+// DefaultIndex is the index used by the symbols command, it is kept while
+// the serve and lsp commands run.
+var DefaultIndex = &Index{}
+
+// Invalidate drops the entries of the files and the directories of the
+// trees with a file in a new directory, or all entries, roots and
+// directories if no files are given.
+func (x *Index) Invalidate(files ...string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(files) == 0 {
+		x.files = nil
+		x.roots = nil
+		x.dirs = nil
+		return
+	}
+	for _, filename := range files {
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		delete(x.files, filename)
+		dir := filepath.Dir(filename)
+		for root, dirs := range x.dirs {
+			if !dirs[dir] && (dir == root.Dir || strings.HasPrefix(dir, root.Dir+string(filepath.Separator))) {
+				delete(x.dirs, root)
+			}
+		}
+	}
+}
+
+// Roots returns the local modules of the workspace of dir, or the GOPATH
+// source directories if dir is not in a module. The roots of dir are
+// loaded once.
+func (x *Index) Roots(dir string, ctx *build.Context, std bool) []Root {
+	key := dir
+	if std {
+		key += "\x00std"
+	}
+	x.mu.Lock()
+	roots, ok := x.roots[key]
+	x.mu.Unlock()
+	if ok {
+		return roots
+	}
+	if ws, err := gomod.LoadWorkspace(dir, ctx); err == nil {
+		for _, m := range ws.LocalModules() {
+			roots = append(roots, Root{Dir: m.Dir, Path: m.Path})
+		}
+	} else {
+		for _, src := range ctx.SrcDirs() {
+			if src != filepath.Join(ctx.GOROOT, "src") {
+				roots = append(roots, Root{Dir: src})
+			}
+		}
+	}
+	if std {
+		roots = append(roots, Root{Dir: filepath.Join(ctx.GOROOT, "src")})
+	}
+	x.mu.Lock()
+	if x.roots == nil {
+		x.roots = make(map[string][]Root)
+	}
+	x.roots[key] = roots
+	x.mu.Unlock()
+	return roots
+}
+
+// Symbols returns the symbols of the go files below the roots, skipping
+// test files unless tests is set. Directories named testdata, vendor or
+// starting with . or _ and the directories of nested modules are skipped.
+func (x *Index) Symbols(roots []Root, tests bool) (list []*Symbol) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	files := make(map[string]*fileEntry)
+	for _, root := range roots {
+		for _, dir := range x.rootDirs(root) {
+			infos, err := ioutil.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			pkg := pkgPath(root, dir)
+			for _, info := range infos {
+				name := info.Name()
+				if info.IsDir() || !strings.HasSuffix(name, ".go") || (!tests && strings.HasSuffix(name, "_test.go")) {
+					continue
+				}
+				path := filepath.Join(dir, name)
+				if _, ok := files[path]; ok {
+					continue
+				}
+				e := x.file(path, info)
+				files[path] = e
+				for _, s := range e.symbols {
+					list = append(list, &Symbol{s, pkg, path})
+				}
+			}
+		}
+	}
+	x.files = files
+	return
+}
+
+// rootDirs returns the sorted directories of root, walking it if it is new
+// or was invalidated.
+func (x *Index) rootDirs(root Root) []string {
+	dirs, ok := x.dirs[root]
+	if !ok {
+		dirs = make(map[string]bool)
+		filepath.Walk(root.Dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+			if path != root.Dir {
+				name := info.Name()
+				if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return filepath.SkipDir
+				}
+				if root.Path != "" {
+					if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+						return filepath.SkipDir
+					}
+				}
+			}
+			dirs[path] = true
+			return nil
+		})
+		if x.dirs == nil {
+			x.dirs = make(map[Root]map[string]bool)
+		}
+		x.dirs[root] = dirs
+	}
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// file returns the entry of the file path, parsing it if it is new or
+// changed. Files of the overlay are always parsed, their entries have no
+// modification time so the file is parsed again without the overlay.
+func (x *Index) file(path string, info os.FileInfo) *fileEntry {
+	src := buildctx.FileSource(path)
+	if e, ok := x.files[path]; ok && src == nil && e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+		return e
+	}
+	e := &fileEntry{size: info.Size(), modTime: info.ModTime()}
+	if src == nil {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return e
+		}
+		src = data
+	} else {
+		e.modTime = time.Time{}
+	}
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, src, 0)
+	if f != nil {
+		e.symbols = astview.FileSymbols(fset, f)
+	}
+	return e
+}
+
+func pkgPath(root Root, dir string) string {
+	rel, err := filepath.Rel(root.Dir, dir)
+	if err != nil || rel == "." {
+		return root.Path
+	}
+	rel = filepath.ToSlash(rel)
+	if root.Path == "" {
+		return rel
+	}
+	return root.Path + "/" + rel
+}
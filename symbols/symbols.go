@@ -0,0 +1,212 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package symbols
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/command"
+)
+
+var Command = &command.Command{
+	Run:       runSymbols,
+	UsageLine: "symbols [-dir dir] [-n max] [-test] [-std] query",
+	Short:     "search the symbols of the workspace",
+	Long: `Symbols prints the types, funcs, methods, fields, consts and vars of the
+current module, or of GOPATH outside of modules, whose names fuzzy match
+the query, best matches first. Methods are named Type.Method. Each line is
+
+	file:line:column: kind name package
+
+Fields are printed as Type.Field.
+
+The symbols of a file are parsed again only when the file changes, so
+repeated queries of the serve and lsp commands are fast.`,
+}
+
+var (
+	symbolsDir     string
+	symbolsMax     int
+	symbolsTest    bool
+	symbolsStd     bool
+	symbolsOverlay string
+)
+
+func init() {
+	Command.Flag.StringVar(&symbolsDir, "dir", "", "workspace directory (default current directory)")
+	Command.Flag.IntVar(&symbolsMax, "n", 100, "maximum number of results, 0 for all")
+	Command.Flag.BoolVar(&symbolsTest, "test", false, "search test files")
+	Command.Flag.BoolVar(&symbolsStd, "std", false, "search the standard library")
+	Command.Flag.StringVar(&symbolsOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
+}
+
+// Match is a symbol matching the query and its score.
+type Match struct {
+	*Symbol
+	Score int `json:"score"`
+}
+
+func runSymbols(cmd *command.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return os.ErrInvalid
+	}
+	if symbolsOverlay != "" {
+		if _, err := buildctx.LoadOverlay(symbolsOverlay, cmd.Stdin); err != nil {
+			return err
+		}
+		defer buildctx.SetOverlay(nil)
+	}
+	dir := symbolsDir
+	if dir == "" || dir == "." {
+		dir, _ = os.Getwd()
+	}
+	roots := DefaultIndex.Roots(dir, buildctx.Default(), symbolsStd)
+	for _, m := range Search(DefaultIndex.Symbols(roots, symbolsTest), args[0], symbolsMax) {
+		name := m.Name
+		if m.Kind == "field" {
+			name = m.Container + "." + name
+		}
+		cmd.PrintResult(m, fmt.Sprintf("%v:%v:%v: %v %v %v", m.Filename, m.Line, m.Column, m.Kind, name, m.Package))
+	}
+	return nil
+}
+
+// Search returns the symbols matching query, best matches first, at most max
+// if max > 0.
+func Search(list []*Symbol, query string, max int) (matches []*Match) {
+	for _, s := range list {
+		score, ok := Score(query, s.Name)
+		if s.Kind == "field" {
+			if n, found := Score(query, s.Container+"."+s.Name); found && (!ok || n > score) {
+				score, ok = n, true
+			}
+		}
+		if ok {
+			matches = append(matches, &Match{s, score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line
+	})
+	if max > 0 && len(matches) > max {
+		matches = matches[:max]
+	}
+	return
+}
+
+// Score reports whether the characters of query appear in order in name,
+// ignoring case, and scores the match. Matches at the start of name, of a
+// camel case word or after . or _ score higher, as do consecutive matches
+// and matching case. An exact match scores highest.
+func Score(query, name string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	if n, ok := fuzzyScore(query, name, true); ok {
+		return n, true
+	}
+	return fuzzyScore(query, name, false)
+}
+
+// fuzzyScore scores the match of query in name. If skip is set, a match in the
+// middle of a word is moved to a later word start, which may fail to match.
+func fuzzyScore(query, name string, skip bool) (int, bool) {
+	score := 0
+	last := -1
+	j := 0
+	for i := 0; i < len(name) && j < len(query); i++ {
+		if lower(name[i]) != lower(query[j]) {
+			continue
+		}
+		// prefer a later word start to a match in the middle of a word
+		if skip && i > 0 && last != i-1 && !wordStart(name, i) {
+			if k := nextWordStart(name, i, query[j]); k != -1 {
+				i = k
+			}
+		}
+		n := 1
+		if i == 0 {
+			n += 8
+		} else if wordStart(name, i) {
+			n += 6
+		}
+		if last != -1 && last == i-1 {
+			n += 4
+		}
+		if name[i] == query[j] {
+			n++
+		}
+		score += n
+		last = i
+		j++
+	}
+	if j < len(query) {
+		return 0, false
+	}
+	switch {
+	case name == query:
+		score += 100
+	case len(name) == len(query):
+		score += 50
+	}
+	return score - (len(name) - len(query)), true
+}
+
+// nextWordStart returns the index of the next word start of name after i
+// matching c, or -1.
+func nextWordStart(name string, i int, c byte) int {
+	for k := i + 1; k < len(name); k++ {
+		if wordStart(name, k) && lower(name[k]) == lower(c) {
+			return k
+		}
+	}
+	return -1
+}
+
+func wordStart(name string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	p, c := name[i-1], name[i]
+	switch {
+	case p == '.' || p == '_':
+		return c != '.' && c != '_'
+	case isUpper(c) && !isUpper(p):
+		return true
+	case isUpper(p) && isUpper(c) && i+1 < len(name) && isLower(name[i+1]):
+		return true
+	}
+	return false
+}
+
+func isUpper(c byte) bool { return 'A' <= c && c <= 'Z' }
+func isLower(c byte) bool { return 'a' <= c && c <= 'z' }
+
+func lower(c byte) byte {
+	if isUpper(c) {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,121 @@
+package symbols
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/visualfc/gotools/astview"
+)
+
+func TestScore(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		names string // matching names, best first
+	}{
+		{"nf", "newFile NewFile nameField NewFileSet inform"},
+		{"newfile", "newFile NewFile NewFileSet"},
+		{"fs", "fs fileSet FileSet NewFileSet"},
+		{"rd", "readDir ReadDir Reader ReadFile orderedDict"},
+	} {
+		var list []*Symbol
+		for _, name := range []string{"NewFile", "newFile", "NewFileSet", "nameField", "inform", "FileSet",
+			"fileSet", "fs", "ReadDir", "readDir", "Reader", "ReadFile", "orderedDict"} {
+			list = append(list, &Symbol{Symbol: &astview.Symbol{Kind: "func", Name: name}})
+		}
+		var names []string
+		for _, m := range Search(list, test.query, 0) {
+			names = append(names, m.Name)
+		}
+		if got := strings.Join(names, " "); got != test.names {
+			t.Errorf("%v: got %q want %q", test.query, got, test.names)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	for _, test := range []struct {
+		query, name string
+		skip        bool
+		score       int
+		ok          bool
+	}{
+		{"ed", "orderedDict", true, 0, true},
+		{"ed", "orderedDict", false, -5, true},
+		{"xy", "axyX", true, 0, false},
+		{"xy", "axyX", false, 6, true},
+		{"fs", "fs", true, 116, true},
+		{"fs", "FileSet", true, 11, true},
+		{"zz", "FileSet", false, 0, false},
+	} {
+		score, ok := fuzzyScore(test.query, test.name, test.skip)
+		if score != test.score || ok != test.ok {
+			t.Errorf("%v %v %v: got %v %v want %v %v", test.query, test.name, test.skip, score, ok, test.score, test.ok)
+		}
+	}
+	// a failed match with skip falls back to the match without
+	if score, ok := Score("xy", "axyX"); score != 6 || !ok {
+		t.Errorf("Score: got %v %v", score, ok)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symbols")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, src string) {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		ioutil.WriteFile(filename, []byte(src), 0644)
+	}
+	write("go.mod", "module example.com/m\n")
+	write("m.go", "package m\n\ntype Point struct {\n\tX int\n}\n\nfunc (p *Point) Move() {}\n")
+	write("geo/geo.go", "package geo\n\nfunc NewPoint() {}\n")
+	write("geo/geo_test.go", "package geo\n\nfunc TestPoint() {}\n")
+	write("testdata/data.go", "package data\n\nfunc PointData() {}\n")
+	write("nested/go.mod", "module example.com/nested\n")
+	write("nested/nested.go", "package nested\n\nfunc NestedPoint() {}\n")
+
+	x := &Index{}
+	roots := x.Roots(dir, &build.Default, false)
+	check := func(query string, tests bool, want string) {
+		t.Helper()
+		var items []string
+		for _, m := range Search(x.Symbols(roots, tests), query, 0) {
+			items = append(items, m.Kind+" "+m.Name+" "+m.Package+" "+filepath.Base(m.Filename))
+		}
+		if got := strings.Join(items, "; "); got != want {
+			t.Fatalf("%v: got\n%v\nwant\n%v", query, got, want)
+		}
+	}
+	for _, test := range []struct {
+		query string
+		tests bool
+		want  string
+	}{
+		{"point", false, "struct Point example.com/m m.go; field X example.com/m m.go; func NewPoint example.com/m/geo geo.go; method Point.Move example.com/m m.go"},
+		{"point", true, "struct Point example.com/m m.go; field X example.com/m m.go; func NewPoint example.com/m/geo geo.go; " +
+			"method Point.Move example.com/m m.go; func TestPoint example.com/m/geo geo_test.go"},
+		{"point.x", false, "field X example.com/m m.go"},
+	} {
+		check(test.query, test.tests, test.want)
+	}
+
+	// a changed file is parsed again
+	write("geo/geo.go", "package geo\n\nfunc NewPointAt() {}\n")
+	future := time.Now().Add(time.Second)
+	os.Chtimes(filepath.Join(dir, "geo/geo.go"), future, future)
+	check("newpoint", false, "func NewPointAt example.com/m/geo geo.go")
+
+	// a new directory is found once a file of it is invalidated
+	write("shape/shape.go", "package shape\n\nfunc NewPointShape() {}\n")
+	check("newpoint", false, "func NewPointAt example.com/m/geo geo.go")
+	x.Invalidate(filepath.Join(dir, "shape/shape.go"))
+	check("newpoint", false, "func NewPointAt example.com/m/geo geo.go; func NewPointShape example.com/m/shape shape.go")
+}
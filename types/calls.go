@@ -0,0 +1,250 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// callEdge is a call site of callee in the function caller.
+type callEdge struct {
+	caller  *types.Func // nil for package initialization
+	callee  *types.Func
+	pos     token.Pos
+	dynamic bool // call of an interface method
+}
+
+// LookupCalls prints the incoming calls (Callers) or outgoing calls (Callees)
+// of the function fn as a tree of Depth levels. Each line is the call site,
+// the name of the caller or callee and its definition, separated by "::",
+// indented by one tab for each level. Calls of interface methods are
+// followed by "::dynamic".
+func (w *PkgWalker) LookupCalls(conf *PkgConfig, obj types.Object) error {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return fmt.Errorf("%s is not a function", obj.Name())
+	}
+	depth := w.findMode.Depth
+	if depth < 1 {
+		depth = 1
+	}
+	if w.findMode.Callers {
+		g := &callGraph{done: make(map[*types.Info]bool)}
+		w.printCallers(conf, g, fn, 1, depth, map[types.Object]bool{})
+	}
+	if w.findMode.Callees {
+		w.printCallees(conf, fn, 1, depth, map[types.Object]bool{})
+	}
+	return nil
+}
+
+// callGraph is the calls of the packages searched for callers so far.
+type callGraph struct {
+	edges []*callEdge
+	done  map[*types.Info]bool
+}
+
+// add adds the calls of the packages not yet searched.
+func (g *callGraph) add(pkgs []*searchPackage) {
+	for _, p := range pkgs {
+		if !g.done[p.info] {
+			g.done[p.info] = true
+			g.edges = append(g.edges, callEdges(p)...)
+		}
+	}
+}
+
+// printCallers prints the callers of fn found in the packages searched for
+// it, so the callers of a caller are searched in the packages that use the
+// package of the caller.
+func (w *PkgWalker) printCallers(conf *PkgConfig, g *callGraph, fn *types.Func, level, depth int, seen map[types.Object]bool) {
+	seen[fn] = true
+	targets := []types.Object{fn}
+	if named, _, ok := parserMethod(fn); ok && !isInterface(named) {
+		ifaces, _ := w.findImplements(conf, fn)
+		targets = append(targets, ifaces...)
+	}
+	g.add(w.searchPackages(conf, targets))
+	var list []*callEdge
+	for _, e := range g.edges {
+		for _, t := range targets {
+			if IsSameObject(e.callee, t, ObjMethod) {
+				list = append(list, e)
+				break
+			}
+		}
+	}
+	sortCallEdges(list)
+	for _, e := range list {
+		if e.caller == nil {
+			w.printCall("caller", level, e, "init", e.pos)
+			continue
+		}
+		w.printCall("caller", level, e, funcName(e.caller), e.caller.Pos())
+		if level < depth && !seen[e.caller] {
+			w.printCallers(conf, g, e.caller, level+1, depth, seen)
+		}
+	}
+}
+
+func (w *PkgWalker) printCallees(conf *PkgConfig, fn *types.Func, level, depth int, seen map[types.Object]bool) {
+	seen[fn] = true
+	p, decl := w.funcDecl(conf, fn)
+	if decl == nil {
+		return
+	}
+	var list []*callEdge
+	done := make(map[string]bool)
+	for _, e := range inspectCalls(p.info, fn, decl.Body) {
+		key := typeString(e.callee.Type()) + e.callee.FullName()
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		list = append(list, e)
+	}
+	sortCallEdges(list)
+	for _, e := range list {
+		w.printCall("callee", level, e, funcName(e.callee), w.sourcePos(e.callee))
+		if level < depth && !e.dynamic && !seen[e.callee] {
+			w.printCallees(conf, e.callee, level+1, depth, seen)
+		}
+	}
+}
+
+func (w *PkgWalker) printCall(kind string, level int, e *callEdge, name string, def token.Pos) {
+	site, end := w.positionRange(e.pos)
+	r := &Result{Kind: kind, Filename: site.Filename, Line: site.Line, Column: site.Column,
+		EndLine: end.Line, EndColumn: end.Column, Name: name, Def: w.position(def).String(), Depth: level, Dynamic: e.dynamic}
+	text := strings.Repeat("\t", level-1) + w.posText(site, end) + "::" + name + "::" + r.Def
+	if e.dynamic {
+		text += "::dynamic"
+	}
+	w.cmd.PrintResult(r, text)
+}
+
+// funcDecl returns the declaration of fn and the package checked with
+// function bodies that declares it.
+func (w *PkgWalker) funcDecl(conf *PkgConfig, fn *types.Func) (*searchPackage, *ast.FuncDecl) {
+	if fn.Pkg() == nil {
+		return nil, nil
+	}
+	pkgs := []*searchPackage{{conf.Pkg, conf.Info, conf.Files}}
+	if conf.XPkg != nil {
+		pkgs = append(pkgs, &searchPackage{conf.XPkg, conf.XInfo, conf.XTestFiles})
+	}
+	if !IsSamePkg(fn.Pkg(), conf.Pkg) && !IsSamePkg(fn.Pkg(), conf.XPkg) {
+		pkg, pkgConf, _ := w.Import("", fn.Pkg().Path(), NewPkgConfig(false, false), nil)
+		if pkg == nil {
+			return nil, nil
+		}
+		pkgs = []*searchPackage{{pkg, pkgConf.Info, pkgConf.Files}}
+	}
+	kind, _ := parserObjKind(fn)
+	for _, p := range pkgs {
+		for _, f := range p.files {
+			for _, decl := range f.Decls {
+				if decl, ok := decl.(*ast.FuncDecl); ok && decl.Body != nil && decl.Name.Name == fn.Name() {
+					if IsSameObject(p.info.Defs[decl.Name], fn, kind) {
+						return p, decl
+					}
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// callEdges returns the calls of functions in the package p.
+func callEdges(p *searchPackage) (edges []*callEdge) {
+	for _, f := range p.files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				caller, _ := p.info.Defs[decl.Name].(*types.Func)
+				if decl.Body != nil && caller != nil {
+					edges = append(edges, inspectCalls(p.info, caller, decl.Body)...)
+				}
+			case *ast.GenDecl:
+				edges = append(edges, inspectCalls(p.info, nil, decl)...)
+			}
+		}
+	}
+	return
+}
+
+// inspectCalls returns the calls of statically resolved functions and of
+// interface methods in node.
+func inspectCalls(info *types.Info, caller *types.Func, node ast.Node) (edges []*callEdge) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fun := uninstance(info, unparen(call.Fun))
+		var id *ast.Ident
+		switch fun := fun.(type) {
+		case *ast.Ident:
+			id = fun
+		case *ast.SelectorExpr:
+			id = fun.Sel
+		default:
+			return true
+		}
+		callee, ok := info.Uses[id].(*types.Func)
+		if !ok {
+			return true
+		}
+		e := &callEdge{caller: caller, callee: callee, pos: id.Pos()}
+		if named, _, ok := parserMethod(callee); ok && isInterface(named) {
+			e.dynamic = true
+		} else if sig, ok := callee.Type().(*types.Signature); ok && sig.Recv() != nil && isInterface(sig.Recv().Type()) {
+			e.dynamic = true
+		}
+		edges = append(edges, e)
+		return true
+	})
+	return
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+func sortCallEdges(edges []*callEdge) {
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].pos < edges[j].pos
+	})
+}
+
+// funcName returns the name of fn qualified by its package or receiver, as
+// in fmt.Println or (*bytes.Buffer).Write.
+func funcName(fn *types.Func) string {
+	qualifier := func(pkg *types.Package) string {
+		return pkg.Name()
+	}
+	if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+		recv := types.TypeString(sig.Recv().Type(), qualifier)
+		if strings.HasPrefix(recv, "*") {
+			recv = "(" + recv + ")"
+		}
+		return recv + "." + fn.Name()
+	}
+	if fn.Pkg() == nil {
+		return fn.Name()
+	}
+	return fn.Pkg().Name() + "." + fn.Name()
+}
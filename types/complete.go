@@ -0,0 +1,513 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/visualfc/gotools/pkg/stdlib"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Completion is a completion candidate at the cursor.
+type Completion struct {
+	Label  string `json:"label"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+	Doc    string `json:"doc,omitempty"`
+	Import string `json:"import,omitempty"` // package to import for the candidate
+	Score  int    `json:"score"`
+}
+
+// docEscaper escapes a doc comment to a single line.
+var docEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+// String returns the candidate as kind,,label,,detail,,doc, with the doc
+// escaped to a single line, and ,,import for a package not yet imported.
+func (c *Completion) String() string {
+	text := c.Kind + ",," + c.Label + ",," + c.Detail + ",," + docEscaper.Replace(c.Doc)
+	if c.Import != "" {
+		text += ",," + c.Import
+	}
+	return text
+}
+
+// completion scores by the context of the candidate.
+const (
+	scoreStructKey = 100
+	scoreMember    = 90
+	scoreLocal     = 80
+	scorePackage   = 60
+	scoreImported  = 50
+	scoreUniverse  = 40
+	scoreKeyword   = 30
+	scoreUnimport  = 20
+)
+
+var keywords = []string{
+	"break", "case", "chan", "const", "continue", "default", "defer", "else",
+	"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+	"map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+}
+
+// completer collects the candidates matching prefix.
+type completer struct {
+	w      *PkgWalker
+	pkg    *types.Package
+	prefix string
+	seen   map[string]bool
+	list   []*Completion
+}
+
+// LookupCompletions returns the identifier prefix before the cursor and the
+// completion candidates for the cursor context ranked by their score:
+// selector members including promoted fields and methods, exports of
+// imported and not yet imported packages, struct literal keys, objects in
+// scope and keywords.
+func (w *PkgWalker) LookupCompletions(conf *PkgConfig, cursor *FileCursor) (string, []*Completion, error) {
+	pkg, info := conf.Pkg, conf.Info
+	if cursor.xtest {
+		pkg, info = conf.XPkg, conf.XInfo
+	}
+	file, _ := w.parseFile(cursor.fileDir, cursor.fileName)
+	if file == nil || pkg == nil {
+		return "", nil, os.ErrNotExist
+	}
+	filename := filepath.Join(cursor.fileDir, cursor.fileName)
+	src := cursor.src
+	if sd, ok := w.fileSourceData[filename]; ok {
+		src = sd.data
+	}
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(filename); err != nil {
+			return "", nil, err
+		}
+	}
+	offset := cursor.byteOffset(src, w.PosEncoding)
+	if offset < 0 || offset > len(src) {
+		return "", nil, os.ErrInvalid
+	}
+	start := offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRune(src[:start])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		start -= size
+	}
+	base := token.Pos(w.FileSet.File(file.Pos()).Base())
+	pos := base + token.Pos(start)
+	c := &completer{w: w, pkg: pkg, prefix: string(src[start:offset]), seen: make(map[string]bool)}
+	for _, group := range file.Comments {
+		if group.Pos() < pos && pos <= group.End() {
+			return c.prefix, nil, nil
+		}
+	}
+	path, _ := astutil.PathEnclosingInterval(file, pos, pos)
+	for _, node := range path {
+		if lit, ok := node.(*ast.BasicLit); ok && lit.Kind == token.STRING && lit.Pos() < pos {
+			return c.prefix, nil, nil
+		}
+	}
+
+	if start > 0 && src[start-1] == '.' {
+		if sel := findSelector(file, pos-1); sel != nil {
+			c.selector(conf, info, sel.X)
+		}
+	} else {
+		if !c.structKeys(info, path, pos) {
+			c.scope(info, file, pos)
+			for _, kw := range keywords {
+				c.add(&Completion{Label: kw, Kind: "keyword", Score: scoreKeyword})
+			}
+		}
+	}
+	sort.SliceStable(c.list, func(i, j int) bool {
+		if c.list[i].Score != c.list[j].Score {
+			return c.list[i].Score > c.list[j].Score
+		}
+		return c.list[i].Label < c.list[j].Label
+	})
+	return c.prefix, c.list, nil
+}
+
+// findSelector returns the selector expression with the dot at pos.
+func findSelector(file *ast.File, dot token.Pos) (sel *ast.SelectorExpr) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel != nil {
+			return false
+		}
+		if expr, ok := n.(*ast.SelectorExpr); ok && expr.X.End() == dot {
+			sel = expr
+			return false
+		}
+		return n == nil || (n.Pos() <= dot && dot <= n.End())
+	})
+	return
+}
+
+// add adds the candidate if its label matches the prefix. Candidates matching
+// the case of the prefix are ranked first.
+func (c *completer) add(item *Completion) {
+	if c.seen[item.Label] || !strings.HasPrefix(strings.ToLower(item.Label), strings.ToLower(c.prefix)) {
+		return
+	}
+	if strings.HasPrefix(item.Label, c.prefix) {
+		item.Score += 5
+	}
+	c.seen[item.Label] = true
+	c.list = append(c.list, item)
+}
+
+func (c *completer) addObject(obj types.Object, score int) {
+	if obj.Pkg() != nil && !obj.Exported() && !IsSamePkg(obj.Pkg(), c.pkg) {
+		return
+	}
+	if !strings.HasPrefix(strings.ToLower(obj.Name()), strings.ToLower(c.prefix)) || obj.Name() == "_" {
+		return
+	}
+	kind, _ := parserObjKind(obj)
+	c.add(&Completion{
+		Label:  obj.Name(),
+		Kind:   kind.String(),
+		Detail: c.detail(obj),
+		Doc:    c.w.objectDoc(obj),
+		Score:  score,
+	})
+}
+
+func (c *completer) qualifier(pkg *types.Package) string {
+	if IsSamePkg(pkg, c.pkg) {
+		return ""
+	}
+	return pkg.Name()
+}
+
+func (c *completer) detail(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return obj.Imported().Path()
+	case *types.Builtin:
+		return builtinInfoMap[obj.Name()]
+	case *types.Nil:
+		return "untyped nil"
+	case *types.TypeName:
+		if obj.IsAlias() {
+			return "= " + types.TypeString(obj.Type(), c.qualifier)
+		}
+		switch obj.Type().Underlying().(type) {
+		case *types.Struct:
+			return "struct"
+		case *types.Interface:
+			return "interface"
+		}
+		return types.TypeString(obj.Type().Underlying(), c.qualifier)
+	case *types.Const:
+		return types.TypeString(obj.Type(), c.qualifier) + " = " + obj.Val().String()
+	}
+	return types.TypeString(obj.Type(), c.qualifier)
+}
+
+// selector adds the members of x: the exports of a package, or the fields
+// and methods of a value or type including the promoted ones.
+func (c *completer) selector(conf *PkgConfig, info *types.Info, x ast.Expr) {
+	if id, ok := x.(*ast.Ident); ok {
+		switch obj := info.Uses[id].(type) {
+		case *types.PkgName:
+			c.packageMembers(obj.Imported(), scoreMember, "")
+			return
+		case nil:
+			if _, ok := info.Types[x]; !ok {
+				c.unimported(conf, id.Name)
+				return
+			}
+		}
+	}
+	tv, ok := info.Types[x]
+	if !ok || tv.Type == nil {
+		return
+	}
+	typ := tv.Type
+	depths := make(map[string]int)
+	if !tv.IsType() {
+		c.fields(typ, depths)
+	}
+	mtyp := typ
+	if _, ok := typ.Underlying().(*types.Interface); !ok && !tv.IsType() {
+		if _, ok := typ.(*types.Pointer); !ok {
+			mtyp = types.NewPointer(typ)
+		}
+	}
+	ms := types.NewMethodSet(mtyp)
+	for i := 0; i < ms.Len(); i++ {
+		sel := ms.At(i)
+		c.addObject(sel.Obj(), scoreMember-2*(len(sel.Index())-1))
+	}
+	for _, name := range sortedKeys(depths) {
+		if obj, _, _ := types.LookupFieldOrMethod(typ, true, c.pkg, name); obj != nil {
+			c.addObject(obj, scoreMember-2*depths[name])
+		}
+	}
+}
+
+// fields records the depth of the fields of typ and of its embedded structs.
+func (c *completer) fields(typ types.Type, depths map[string]int) {
+	type embedded struct {
+		typ   types.Type
+		depth int
+	}
+	seen := make(map[types.Type]bool)
+	list := []embedded{{typ, 0}}
+	for len(list) > 0 {
+		e := list[0]
+		list = list[1:]
+		t := orgType(e.typ)
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if _, ok := depths[f.Name()]; !ok {
+				depths[f.Name()] = e.depth
+			}
+			if f.Anonymous() {
+				list = append(list, embedded{f.Type(), e.depth + 1})
+			}
+		}
+	}
+}
+
+func sortedKeys(m map[string]int) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func (c *completer) packageMembers(pkg *types.Package, score int, importPath string) {
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		n := len(c.list)
+		c.addObject(obj, score)
+		if len(c.list) > n {
+			c.list[n].Import = importPath
+		}
+	}
+}
+
+// unimported adds the exports of the not yet imported packages named name
+// found in the standard library and in the current module.
+func (c *completer) unimported(conf *PkgConfig, name string) {
+	var paths []string
+	for _, path := range stdlib.Packages {
+		if pathName(path) == name && !strings.Contains(path, "internal") {
+			paths = append(paths, path)
+		}
+	}
+	w := c.w
+	if w.Mod != nil {
+		root := w.Mod.Root()
+		paths = append(paths, w.modulePackages(root.Dir, root.Path).byName[name]...)
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i]) < len(paths[j])
+	})
+	im := &Importer{w, NewPkgConfig(true, false), conf.Bpkg.Dir}
+	for i, path := range paths {
+		pkg, _ := im.Import(path)
+		if pkg != nil && pkg.Name() == name {
+			c.packageMembers(pkg, scoreUnimport-i, path)
+		}
+	}
+}
+
+// modPackages is the list of the packages of a module.
+type modPackages struct {
+	dirs   map[string]bool     // directories of the packages
+	byName map[string][]string // import paths by package name
+}
+
+// modulePackages returns the packages, not commands, of the module in dir
+// with path. The module is walked once per walker, InvalidateCache drops
+// the list if a file outside of its package directories is invalidated.
+func (w *PkgWalker) modulePackages(dir string, modPath string) *modPackages {
+	if pkgs, ok := w.modPkgs[dir]; ok {
+		return pkgs
+	}
+	pkgs := &modPackages{dirs: make(map[string]bool), byName: make(map[string][]string)}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != dir && (info.Name() == "vendor" || info.Name() == "testdata" || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if bp, err := w.importPath(dir, path, 0); err == nil && !bp.IsCommand() {
+			importPath := modPath
+			if path != dir {
+				importPath = modPath + "/" + filepath.ToSlash(path[len(dir)+1:])
+			}
+			pkgs.dirs[path] = true
+			pkgs.byName[bp.Name] = append(pkgs.byName[bp.Name], importPath)
+		}
+		return nil
+	})
+	w.modPkgs[dir] = pkgs
+	return pkgs
+}
+
+func pathName(importPath string) string {
+	name := path.Base(importPath)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.Replace(name, "-", "_", -1)
+}
+
+// structKeys adds the unused field names when the cursor is at a key of a
+// struct literal.
+func (c *completer) structKeys(info *types.Info, path []ast.Node, pos token.Pos) bool {
+	for i, node := range path {
+		switch node := node.(type) {
+		case *ast.KeyValueExpr:
+			if pos > node.Colon {
+				return false
+			}
+		case *ast.CompositeLit:
+			if pos <= node.Lbrace || (i > 0 && path[i-1] == node.Type) {
+				return false
+			}
+			tv, ok := info.Types[node]
+			if !ok || tv.Type == nil {
+				return false
+			}
+			st, ok := orgType(tv.Type).Underlying().(*types.Struct)
+			if !ok {
+				return false
+			}
+			used := make(map[string]bool)
+			for _, elt := range node.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := kv.Key.(*ast.Ident); ok && id.End() < pos {
+						used[id.Name] = true
+					}
+				}
+			}
+			for j := 0; j < st.NumFields(); j++ {
+				if f := st.Field(j); !used[f.Name()] {
+					c.addObject(f, scoreStructKey)
+				}
+			}
+			return true
+		case *ast.FuncLit, *ast.BlockStmt:
+			return false
+		}
+	}
+	return false
+}
+
+// scope adds the objects declared before pos in the scopes enclosing pos.
+func (c *completer) scope(info *types.Info, file *ast.File, pos token.Pos) {
+	fileScope := info.Scopes[file]
+	if fileScope == nil {
+		return
+	}
+	level := 0
+	for s := findScope(fileScope, pos); s != nil; s = s.Parent() {
+		score, local := scoreLocal-level, false
+		switch s {
+		case types.Universe:
+			score = scoreUniverse
+		case fileScope:
+			score = scoreImported
+		case c.pkg.Scope():
+			score = scorePackage
+		default:
+			local = true
+		}
+		for _, name := range s.Names() {
+			obj := s.Lookup(name)
+			if local && obj.Pos() > pos {
+				continue
+			}
+			c.addObject(obj, score)
+		}
+		level++
+	}
+}
+
+// objectDoc returns the doc comment of the declaration of obj.
+func (w *PkgWalker) objectDoc(obj types.Object) string {
+	for _, node := range w.declPath(obj) {
+		var doc *ast.CommentGroup
+		switch node := node.(type) {
+		case *ast.Field:
+			doc = node.Doc
+			if doc == nil {
+				doc = node.Comment
+			}
+			if doc == nil {
+				return ""
+			}
+		case *ast.ValueSpec:
+			doc = node.Doc
+			if doc == nil {
+				doc = node.Comment
+			}
+		case *ast.TypeSpec:
+			doc = node.Doc
+		case *ast.GenDecl:
+			doc = node.Doc
+		case *ast.FuncDecl:
+			doc = node.Doc
+		case ast.Stmt:
+			return ""
+		}
+		if doc != nil {
+			return doc.Text()
+		}
+	}
+	return ""
+}
+
+// declPath returns the path of ast nodes enclosing the declaration of obj in
+// the parsed source files.
+func (w *PkgWalker) declPath(obj types.Object) []ast.Node {
+	if _, ok := obj.(*types.PkgName); ok {
+		return nil
+	}
+	p := w.sourcePos(obj)
+	if !p.IsValid() {
+		return nil
+	}
+	pos := w.FileSet.Position(p)
+	file := w.ParsedFileCache[pos.Filename]
+	if file == nil || w.FileSet.File(file.Pos()) != w.FileSet.File(p) {
+		return nil
+	}
+	path, _ := astutil.PathEnclosingInterval(file, p, p)
+	return path
+}
@@ -0,0 +1,95 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Diagnostic is a parse or type error of a checked package. Unused imports
+// and variables have the severity "warning", other errors "error".
+type Diagnostic struct {
+	Filename  string `json:"filename"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+func (d *Diagnostic) String() string {
+	pos := token.Position{Filename: d.Filename, Line: d.Line, Column: d.Column}
+	return pos.String() + ": " + d.Severity + ": " + d.Message
+}
+
+// Diagnostics returns the errors recorded by the last check of conf sorted
+// by position. The range of a type error covers the expression it reports.
+func (w *PkgWalker) Diagnostics(conf *PkgConfig) (list []*Diagnostic) {
+	add := func(start, end token.Position, severity, msg string) {
+		if !end.IsValid() {
+			end = start
+		}
+		start, end = w.posConv.Position(start), w.posConv.Position(end)
+		list = append(list, &Diagnostic{Filename: start.Filename, Line: start.Line, Column: start.Column,
+			EndLine: end.Line, EndColumn: end.Column, Severity: severity, Message: msg})
+	}
+	for _, err := range conf.Errors {
+		switch err := err.(type) {
+		case scanner.ErrorList:
+			for _, e := range err {
+				add(e.Pos, e.Pos, "error", e.Msg)
+			}
+		case *scanner.Error:
+			add(err.Pos, err.Pos, "error", err.Msg)
+		case types.Error:
+			severity := "error"
+			if err.Soft && strings.Contains(err.Msg, "not used") {
+				severity = "warning"
+			}
+			add(w.FileSet.Position(err.Pos), w.FileSet.Position(w.errorEnd(err.Pos)), severity, err.Msg)
+		default:
+			add(token.Position{}, token.Position{}, "error", err.Error())
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return
+}
+
+// errorEnd returns the end of the innermost node starting at pos.
+func (w *PkgWalker) errorEnd(pos token.Pos) token.Pos {
+	tf := w.FileSet.File(pos)
+	if tf == nil {
+		return token.NoPos
+	}
+	file := w.ParsedFileCache[tf.Name()]
+	if file == nil || pos < file.Pos() || pos > file.End() {
+		return token.NoPos
+	}
+	path, _ := astutil.PathEnclosingInterval(file, pos, pos)
+	if len(path) == 0 || path[0].Pos() != pos {
+		return token.NoPos
+	}
+	if _, ok := path[0].(*ast.File); ok {
+		return token.NoPos
+	}
+	return path[0].End()
+}
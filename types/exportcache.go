@@ -0,0 +1,176 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"bytes"
+	"go/build"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/tools/go/gcexportdata"
+
+	"github.com/visualfc/gotools/pkg/pkgcache"
+)
+
+// exportKey returns the cache key of the package bp: a hash of the build
+// context, the Go version, the contents of the Go files of bp and the keys
+// of its imports. It returns "" if an import cannot be resolved.
+func (w *PkgWalker) exportKey(bp *build.Package, stack map[string]bool) string {
+	if key, ok := w.exportKeys[bp.Dir]; ok {
+		return key
+	}
+	if stack[bp.Dir] {
+		return ""
+	}
+	stack[bp.Dir] = true
+	defer delete(stack, bp.Dir)
+
+	k := pkgcache.NewKey()
+	k.Add(runtime.Version(), contextKey(w.Context), bp.ImportPath, bp.Dir)
+	for _, file := range append(append([]string{}, bp.GoFiles...), bp.CgoFiles...) {
+		filename := filepath.Join(bp.Dir, file)
+		data, err := w.fileData(filename)
+		if err != nil {
+			return ""
+		}
+		k.Add(file)
+		k.AddData(data)
+	}
+	for _, path := range bp.Imports {
+		if path == "C" || path == "unsafe" {
+			continue
+		}
+		if w.isBinaryPkg(path) {
+			k.Add(path)
+			continue
+		}
+		name, err := w.resolveImport(bp.Dir, path)
+		if err != nil {
+			return ""
+		}
+		dep, err := w.importPath(bp.Dir, name, 0)
+		if dep == nil {
+			return ""
+		}
+		key := w.exportKey(dep, stack)
+		if key == "" {
+			return ""
+		}
+		k.Add(path, key)
+	}
+	key := k.String()
+	w.exportKeys[bp.Dir] = key
+	return key
+}
+
+func (w *PkgWalker) fileData(filename string) ([]byte, error) {
+	if sd, ok := w.fileSourceData[filename]; ok {
+		return sd.data, nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// importExport returns the package imported as name by the package in dir
+// from the export data cache, or nil if the cache has no current entry. The
+// imports of the package are imported first so its export data refers to
+// the same packages.
+func (w *PkgWalker) importExport(dir string, name string) *types.Package {
+	if w.ExportCache == nil {
+		return nil
+	}
+	name, err := w.resolveImport(dir, name)
+	if err != nil {
+		return nil
+	}
+	bp, _ := w.importPath(dir, name, 0)
+	if bp == nil {
+		return nil
+	}
+	key := w.exportKey(bp, make(map[string]bool))
+	if key == "" {
+		return nil
+	}
+	if pkg := w.Imported[name]; pkg != nil {
+		k, ok := w.exportPkgs[pkg]
+		if !ok {
+			// checked from source, ImportHelper validates it
+			return nil
+		}
+		if k == key {
+			return pkg
+		}
+	}
+	data, err := w.ExportCache.Get(key)
+	if err != nil {
+		return nil
+	}
+	im := &Importer{w, NewPkgConfig(true, false), bp.Dir}
+	for _, path := range bp.Imports {
+		if path == "C" || path == "unsafe" {
+			continue
+		}
+		if pkg, err := im.Import(path); pkg == nil {
+			if typesVerbose {
+				w.cmd.Println("export data", name, err)
+			}
+			return nil
+		}
+	}
+	imports := make(map[string]*types.Package)
+	for _, pkg := range w.Imported {
+		if pkg != nil && w.Imported[pkg.Path()] == pkg {
+			imports[pkg.Path()] = pkg
+		}
+	}
+	delete(imports, bp.ImportPath)
+	pkg, err := gcexportdata.Read(bytes.NewReader(data), w.FileSet, imports, bp.ImportPath)
+	if err != nil {
+		if typesVerbose {
+			w.cmd.Println("export data", name, err)
+		}
+		return nil
+	}
+	w.Imported[name] = pkg
+	w.exportPkgs[pkg] = key
+	delete(w.ImportedFilesCheck, name)
+	delete(w.ImportedConfig, name)
+	return pkg
+}
+
+// storeExport writes the export data of pkg checked from source with conf
+// to the cache. Packages with errors are not stored.
+func (w *PkgWalker) storeExport(pkg *types.Package, conf *PkgConfig) {
+	if w.ExportCache == nil || conf == nil || conf.Bpkg == nil || len(conf.Errors) > 0 {
+		return
+	}
+	if _, ok := w.exportPkgs[pkg]; ok {
+		return
+	}
+	key := w.exportKey(conf.Bpkg, make(map[string]bool))
+	if key == "" || w.ExportCache.Has(key) {
+		return
+	}
+	var buf bytes.Buffer
+	// types not supported by the export format, such as aliases, fail here
+	if err := gcexportdata.Write(&buf, w.FileSet, pkg); err != nil {
+		if typesVerbose {
+			w.cmd.Println("export data", pkg.Path(), err)
+		}
+		return
+	}
+	w.ExportCache.Put(key, buf.Bytes())
+}
+
+// fromExportData reports whether pkg was imported from export data, so its
+// objects have no syntax in the parsed files.
+func (w *PkgWalker) fromExportData(pkg *types.Package) bool {
+	if _, ok := w.exportPkgs[pkg]; ok {
+		return true
+	}
+	return w.isBinaryPkg(pkg.Path())
+}
@@ -0,0 +1,123 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// LookupHighlight prints the ranges of the identifiers of the cursor file
+// denoting the cursor object obj, or the package imported at the cursor,
+// of kind definition, read or write. Writes are the operands of
+// assignments, compound assignments, ++ and --, range clauses assigning to
+// existing variables and &, and the keys of struct literals. Only the file
+// and info are inspected.
+func (w *PkgWalker) LookupHighlight(info *types.Info, cursor *FileCursor, obj types.Object) error {
+	file, _ := w.parseFile(cursor.fileDir, cursor.fileName)
+	if file == nil {
+		return fmt.Errorf("not found file %v", cursor.fileName)
+	}
+	if obj == nil {
+		for _, spec := range file.Imports {
+			if cursor.pos < spec.Pos() || cursor.pos > spec.End() {
+				continue
+			}
+			if spec.Name != nil {
+				obj = info.Defs[spec.Name]
+			} else {
+				obj = info.Implicits[spec]
+			}
+		}
+	}
+	if obj == nil {
+		return fmt.Errorf("not found object")
+	}
+	// the objects of the instances of generic types have the origin position
+	same := func(o types.Object) bool {
+		return o == obj || (o != nil && o.Pos().IsValid() && o.Pos() == obj.Pos() && o.Name() == obj.Name())
+	}
+
+	writes := make(map[*ast.Ident]bool)
+	var write func(expr ast.Expr)
+	write = func(expr ast.Expr) {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			writes[e] = true
+		case *ast.ParenExpr:
+			write(e.X)
+		case *ast.SelectorExpr:
+			write(e.Sel)
+		case *ast.IndexExpr:
+			write(e.X)
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				write(lhs)
+			}
+		case *ast.IncDecStmt:
+			write(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				if n.Key != nil {
+					write(n.Key)
+				}
+				if n.Value != nil {
+					write(n.Value)
+				}
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				write(n.X)
+			}
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := kv.Key.(*ast.Ident); ok {
+						if _, ok := info.Uses[id].(*types.Var); ok {
+							writes[id] = true
+						}
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	var ids []*ast.Ident
+	kinds := make(map[*ast.Ident]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if o, ok := info.Defs[id]; ok && same(o) {
+			kinds[id] = "definition"
+		} else if o, ok := info.Uses[id]; ok && same(o) {
+			kinds[id] = "read"
+			if writes[id] {
+				kinds[id] = "write"
+			}
+		} else {
+			return true
+		}
+		ids = append(ids, id)
+		return true
+	})
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+	for _, id := range ids {
+		pos := w.position(id.Pos())
+		end := w.position(id.End())
+		w.cmd.PrintResult(&Result{Kind: kinds[id], Filename: pos.Filename, Line: pos.Line, Column: pos.Column, EndLine: end.Line, EndColumn: end.Column},
+			fmt.Sprintf("%s:%d:%d-%d %s", pos.Filename, pos.Line, pos.Column, end.Column, kinds[id]))
+	}
+	return nil
+}
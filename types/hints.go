@@ -0,0 +1,176 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+
+	"github.com/visualfc/gotools/pkg/typeparams"
+)
+
+// InlayHint is a label shown inline at a position of a file. Kind is one of
+// parameter for the parameter names of literal arguments, type for the
+// types of the variables declared by := and range clauses, typeArgs for the
+// inferred type arguments of generic calls and value for the values of
+// constants declared with iota.
+type InlayHint struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Kind   string `json:"kind"`
+	Label  string `json:"label"`
+}
+
+// LookupInlayHints returns the inlay hints of the cursor file between the
+// lines from and to, all if to is 0, in source order.
+func (w *PkgWalker) LookupInlayHints(conf *PkgConfig, cursor *FileCursor, from, to int) ([]*InlayHint, error) {
+	pkg, info := conf.Pkg, conf.Info
+	if cursor.xtest {
+		pkg, info = conf.XPkg, conf.XInfo
+	}
+	file, _ := w.parseFile(cursor.fileDir, cursor.fileName)
+	if file == nil || pkg == nil {
+		return nil, os.ErrNotExist
+	}
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, pkg) {
+			return ""
+		}
+		return p.Name()
+	}
+	type hint struct {
+		pos   token.Pos
+		kind  string
+		label string
+	}
+	var hints []*hint
+	add := func(pos token.Pos, kind, label string) {
+		line := w.FileSet.Position(pos).Line
+		if line < from || (to > 0 && line > to) {
+			return
+		}
+		hints = append(hints, &hint{pos, kind, label})
+	}
+	define := func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			id, ok := expr.(*ast.Ident)
+			if !ok || id.Name == "_" {
+				continue
+			}
+			if obj := info.Defs[id]; obj != nil {
+				add(id.End(), "type", types.TypeString(obj.Type(), qualifier))
+			}
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				define(n.Lhs...)
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				define(n.Key, n.Value)
+			}
+		case *ast.CallExpr:
+			var id *ast.Ident
+			switch fun := n.Fun.(type) {
+			case *ast.Ident:
+				id = fun
+			case *ast.SelectorExpr:
+				id = fun.Sel
+			}
+			if id != nil {
+				if targs := typeparams.TypeArgs(info, id, qualifier); targs != "" {
+					add(id.End(), "typeArgs", targs)
+				}
+			}
+			tv, ok := info.Types[n.Fun]
+			if !ok || tv.IsType() {
+				return true
+			}
+			sig, ok := tv.Type.Underlying().(*types.Signature)
+			if !ok {
+				return true
+			}
+			params := sig.Params()
+			for i, arg := range n.Args {
+				if params.Len() == 0 || !isLiteralArg(info, arg) {
+					continue
+				}
+				variadic := sig.Variadic() && i >= params.Len()-1 && !n.Ellipsis.IsValid()
+				if i >= params.Len() && !variadic {
+					break
+				}
+				if variadic && i > params.Len()-1 {
+					continue
+				}
+				name := params.At(i).Name()
+				if name == "" || name == "_" {
+					continue
+				}
+				if variadic {
+					name += "..."
+				}
+				add(arg.Pos(), "parameter", name+":")
+			}
+		case *ast.GenDecl:
+			if n.Tok != token.CONST || !usesIota(info, n) {
+				return true
+			}
+			for _, spec := range n.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Values) > 0 && !usesIota(info, vs) {
+					continue
+				}
+				for _, id := range vs.Names {
+					if c, ok := info.Defs[id].(*types.Const); ok && id.Name != "_" {
+						add(id.End(), "value", "= "+c.Val().ExactString())
+					}
+				}
+			}
+		}
+		return true
+	})
+	sort.SliceStable(hints, func(i, j int) bool { return hints[i].pos < hints[j].pos })
+	var list []*InlayHint
+	for _, h := range hints {
+		pos := w.position(h.pos)
+		list = append(list, &InlayHint{Line: pos.Line, Column: pos.Column, Kind: h.kind, Label: h.label})
+	}
+	return list, nil
+}
+
+// isLiteralArg reports whether arg is a basic, composite or func literal,
+// a negated number or one of nil, true and false.
+func isLiteralArg(info *types.Info, arg ast.Expr) bool {
+	switch e := arg.(type) {
+	case *ast.BasicLit, *ast.CompositeLit, *ast.FuncLit:
+		return true
+	case *ast.UnaryExpr:
+		_, ok := e.X.(*ast.BasicLit)
+		return ok && (e.Op == token.SUB || e.Op == token.ADD)
+	case *ast.Ident:
+		obj := info.Uses[e]
+		return obj != nil && obj.Pkg() == nil && (e.Name == "nil" || e.Name == "true" || e.Name == "false")
+	}
+	return false
+}
+
+// usesIota reports whether the node uses the predeclared iota.
+func usesIota(info *types.Info, node ast.Node) (found bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+			if obj := info.Uses[id]; obj != nil && obj.Pkg() == nil {
+				found = true
+			}
+		}
+		return !found
+	})
+	return
+}
@@ -0,0 +1,324 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/visualfc/gotools/pkg/stdlib"
+)
+
+// ImplStubs are the method stubs of the methods a type is missing to
+// implement an interface, and the end of the type declaration to insert
+// them after.
+type ImplStubs struct {
+	Type      string   `json:"type"`
+	Interface string   `json:"interface"`
+	Filename  string   `json:"filename"`
+	Offset    int      `json:"offset"`            // byte offset of the end of the type declaration
+	Imports   []string `json:"imports,omitempty"` // paths of the packages the stubs refer to but the file does not import
+	Methods   []string `json:"methods"`
+	Code      string   `json:"code"`
+}
+
+// ImplementStubs returns the stubs of the methods of the interface iface
+// missing from the method set of the receiver recv, given as T, *T or t *T
+// and declared in the package of conf, or of the type at the cursor if recv
+// is empty. The interface is a name of the package, pkg.Name with a package
+// imported by it or importpath.Name. The receiver name defaults to the one
+// of the existing methods of the type, as does the pointer receiver for the
+// type at the cursor. The receiver is a pointer if methods of the interface
+// are only in the method set of *T. The doc comments of the interface
+// methods are copied; the comments of the sources must be parsed for them.
+func (w *PkgWalker) ImplementStubs(conf *PkgConfig, cursor *FileCursor, recv string, iface string) (*ImplStubs, error) {
+	pkg, info := conf.Pkg, conf.Info
+	if cursor != nil {
+		w.updateCursor(cursor)
+		if cursor.xtest {
+			pkg, info = conf.XPkg, conf.XInfo
+		}
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf("not found package")
+	}
+	var recvName string
+	var ptr, ptrSet bool
+	var tn *types.TypeName
+	if recv != "" {
+		fields := strings.Fields(recv)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid receiver %q", recv)
+		}
+		if len(fields) == 2 {
+			recvName = fields[0]
+		}
+		name := fields[len(fields)-1]
+		ptr, ptrSet = strings.HasPrefix(name, "*"), true
+		name = strings.TrimPrefix(name, "*")
+		tn, _ = pkg.Scope().Lookup(name).(*types.TypeName)
+		if tn == nil {
+			return nil, fmt.Errorf("not found type %v in package %v", name, pkg.Path())
+		}
+	} else if cursor != nil {
+		obj, _ := w.CheckIsObject(cursor, info)
+		if obj == nil {
+			return nil, fmt.Errorf("not found object")
+		}
+		if t, ok := obj.(*types.TypeName); ok {
+			tn = t
+		} else if named, ok := orgType(obj.Type()).(*types.Named); ok {
+			tn = named.Obj()
+		}
+		if tn == nil || tn.Pkg() != pkg {
+			return nil, fmt.Errorf("%v is not a type of package %v", obj.Name(), pkg.Path())
+		}
+	} else {
+		return nil, fmt.Errorf("no receiver type")
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || tn.IsAlias() {
+		return nil, fmt.Errorf("%v is not a defined type", tn.Name())
+	}
+	if isInterface(named) {
+		return nil, fmt.Errorf("%v is an interface", tn.Name())
+	}
+
+	pos := w.FileSet.Position(tn.Pos())
+	file := w.ParsedFileCache[pos.Filename]
+	if file == nil {
+		return nil, fmt.Errorf("not found file %v", pos.Filename)
+	}
+	dir := ""
+	if conf.Bpkg != nil {
+		dir = conf.Bpkg.Dir
+	}
+	itn, err := w.lookupInterface(dir, pkg, file, iface)
+	if err != nil {
+		return nil, err
+	}
+
+	// existing methods decide the receiver name and pointer
+	var ptrs, values int
+	for i := 0; i < named.NumMethods(); i++ {
+		sig := named.Method(i).Type().(*types.Signature)
+		if recvName == "" {
+			if name := sig.Recv().Name(); name != "" && name != "_" {
+				recvName = name
+			}
+		}
+		if _, ok := sig.Recv().Type().(*types.Pointer); ok {
+			ptrs++
+		} else {
+			values++
+		}
+	}
+	if !ptrSet {
+		_, isStruct := named.Underlying().(*types.Struct)
+		ptr = ptrs > 0 || (values == 0 && isStruct)
+	}
+
+	fileImports := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			fileImports[path] = spec.Name.Name
+		} else if p := importedPackage(pkg, path); p != nil {
+			fileImports[path] = p.Name()
+		}
+	}
+	imports := make(map[string]bool)
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, pkg) {
+			return ""
+		}
+		if name, ok := fileImports[p.Path()]; ok && name != "_" {
+			if name == "." {
+				return ""
+			}
+			return name
+		}
+		imports[p.Path()] = true
+		return p.Name()
+	}
+
+	// methods of *T missing from the method set of T make only *T
+	// implement the interface, so the stubs get a pointer receiver too
+	ifaceType := itn.Type().Underlying().(*types.Interface)
+	valueMethods, ptrMethods := types.NewMethodSet(named), types.NewMethodSet(types.NewPointer(named))
+	for i := 0; i < ifaceType.NumMethods() && !ptr; i++ {
+		m := ifaceType.Method(i)
+		if valueMethods.Lookup(m.Pkg(), m.Name()) == nil && ptrMethods.Lookup(m.Pkg(), m.Name()) != nil {
+			ptr = true
+		}
+	}
+	var missing []*types.Func
+	for i := 0; i < ifaceType.NumMethods(); i++ {
+		m := ifaceType.Method(i)
+		obj, _, _ := types.LookupFieldOrMethod(named, true, m.Pkg(), m.Name())
+		if obj == nil {
+			if !m.Exported() && !IsSamePkg(m.Pkg(), pkg) {
+				return nil, fmt.Errorf("cannot implement unexported method %v of %v", m.Name(), iface)
+			}
+			missing = append(missing, m)
+			continue
+		}
+		fn, ok := obj.(*types.Func)
+		if !ok {
+			return nil, fmt.Errorf("%v has field %v of interface method %v", tn.Name(), obj.Name(), m.Name())
+		}
+		if sigString(fn.Type()) != sigString(m.Type()) {
+			return nil, fmt.Errorf("%v.%v has signature %v, %v wants %v", tn.Name(), fn.Name(), fn.Type(), iface, m.Type())
+		}
+	}
+
+	if recvName == "" {
+		recvName = defaultRecvName(tn.Name(), missing)
+	}
+	star := ""
+	if ptr {
+		star = "*"
+	}
+	stubs := &ImplStubs{Type: star + tn.Name(), Interface: iface, Filename: pos.Filename,
+		Offset: w.FileSet.Position(typeDeclEnd(file, tn)).Offset}
+	var buf bytes.Buffer
+	for _, m := range missing {
+		if doc := w.methodDoc(m); doc != nil {
+			for _, c := range doc.List {
+				buf.WriteString(c.Text + "\n")
+			}
+		}
+		sig := strings.TrimPrefix(types.TypeString(m.Type(), qualifier), "func")
+		fmt.Fprintf(&buf, "func (%v %v%v%v) %v%v {\n\tpanic(\"not implemented\") // TODO: Implement\n}\n\n",
+			recvName, star, tn.Name(), typeParamNames(named), m.Name(), sig)
+		stubs.Methods = append(stubs.Methods, m.Name())
+	}
+	stubs.Code = buf.String()
+	for path := range imports {
+		stubs.Imports = append(stubs.Imports, path)
+	}
+	sort.Strings(stubs.Imports)
+	return stubs, nil
+}
+
+// lookupInterface returns the interface named name for the package pkg in
+// dir and its file, if any.
+func (w *PkgWalker) lookupInterface(dir string, pkg *types.Package, file *ast.File, name string) (*types.TypeName, error) {
+	scope := pkg.Scope()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		path := name[:i]
+		var found *types.Package
+		if file != nil {
+			for _, spec := range file.Imports {
+				p, _ := strconv.Unquote(spec.Path.Value)
+				if spec.Name != nil && spec.Name.Name == path {
+					found = importedPackage(pkg, p)
+				}
+			}
+		}
+		if found == nil {
+			for _, p := range pkg.Imports() {
+				if p.Name() == path || p.Path() == path {
+					found = p
+				}
+			}
+		}
+		if found == nil {
+			if !strings.Contains(path, "/") && !stdlib.IsStdPkg(path) {
+				// a standard library package by name, as http for net/http
+				for _, p := range stdlib.Packages {
+					if strings.HasSuffix(p, "/"+path) && !strings.Contains(p, "internal") {
+						path = p
+						break
+					}
+				}
+			}
+			// errors of the imported package do not matter for its interfaces
+			found, _, _ = w.Import(dir, path, NewPkgConfig(true, false), nil)
+		}
+		if found == nil {
+			return nil, fmt.Errorf("not found package %v", path)
+		}
+		scope, name = found.Scope(), name[i+1:]
+	}
+	tn, ok := scope.Lookup(name).(*types.TypeName)
+	if !ok || !isInterface(tn.Type()) {
+		return nil, fmt.Errorf("not found interface %v", name)
+	}
+	return tn, nil
+}
+
+func importedPackage(pkg *types.Package, path string) *types.Package {
+	for _, p := range pkg.Imports() {
+		if p.Path() == path || strings.HasSuffix(p.Path(), "/vendor/"+path) {
+			return p
+		}
+	}
+	return nil
+}
+
+// sigString returns the signature of a method with package paths.
+func sigString(typ types.Type) string {
+	return types.TypeString(typ, func(p *types.Package) string { return p.Path() })
+}
+
+// defaultRecvName returns the lower case first letter of the type name, or
+// the type name or recv if a parameter of the methods has the name.
+func defaultRecvName(typeName string, methods []*types.Func) string {
+	used := make(map[string]bool)
+	for _, m := range methods {
+		sig := m.Type().(*types.Signature)
+		for _, tuple := range []*types.Tuple{sig.Params(), sig.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				used[tuple.At(i).Name()] = true
+			}
+		}
+	}
+	r := []rune(typeName)
+	for _, name := range []string{string(unicode.ToLower(r[0])), strings.ToLower(typeName), "recv"} {
+		if !used[name] {
+			return name
+		}
+	}
+	return "_"
+}
+
+// typeDeclEnd returns the end of the type declaration, the group of type
+// specs included, of the type name tn in file.
+func typeDeclEnd(file *ast.File, tn *types.TypeName) token.Pos {
+	for _, decl := range file.Decls {
+		if decl.Pos() <= tn.Pos() && tn.Pos() < decl.End() {
+			return decl.End()
+		}
+	}
+	return file.End()
+}
+
+// methodDoc returns the doc comment of the interface method m.
+func (w *PkgWalker) methodDoc(m *types.Func) (doc *ast.CommentGroup) {
+	pos := w.sourcePos(m)
+	file := w.ParsedFileCache[w.FileSet.Position(pos).Filename]
+	if file == nil || pos < file.Pos() || pos > file.End() {
+		return nil
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok {
+			for _, id := range field.Names {
+				if id.Pos() == pos {
+					doc = field.Doc
+				}
+			}
+		}
+		return doc == nil
+	})
+	return
+}
@@ -0,0 +1,270 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// LookupImplements prints the positions of the concrete types implementing
+// the interface cursorObj, or of the interfaces implemented by the concrete
+// type cursorObj. For methods it prints the matching methods.
+func (w *PkgWalker) LookupImplements(conf *PkgConfig, cursorObj types.Object) error {
+	found, err := w.findImplements(conf, cursorObj)
+	if err != nil {
+		return err
+	}
+	var positions []token.Position
+	for _, obj := range found {
+		positions = append(positions, w.FileSet.Position(w.sourcePos(obj)))
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Filename != positions[j].Filename {
+			return positions[i].Filename < positions[j].Filename
+		}
+		return positions[i].Offset < positions[j].Offset
+	})
+	var last token.Position
+	for _, pos := range positions {
+		if pos == last {
+			continue
+		}
+		last = pos
+		start, end := w.posConv.Range(pos)
+		w.cmd.PrintResult(&Result{Kind: "impl", Filename: start.Filename, Line: start.Line, Column: start.Column,
+			EndLine: end.Line, EndColumn: end.Column}, w.posText(start, end))
+	}
+	return nil
+}
+
+func (w *PkgWalker) findImplements(conf *PkgConfig, cursorObj types.Object) (found []types.Object, err error) {
+	var named *types.Named
+	var method *types.Func
+	switch obj := cursorObj.(type) {
+	case *types.TypeName:
+		named, _ = obj.Type().(*types.Named)
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		if sig.Recv() == nil {
+			return nil, fmt.Errorf("%s is not a method", obj.Name())
+		}
+		named, _ = parseNamed(sig.Recv().Type())
+		method = obj
+	}
+	if named == nil {
+		return nil, fmt.Errorf("%s is not a named type or method", cursorObj.Name())
+	}
+	pkgs := w.implementsPackages(conf, named.Obj().Pkg())
+
+	if iface, ok := named.Underlying().(*types.Interface); ok {
+		if iface.NumMethods() == 0 {
+			return nil, nil
+		}
+		for _, T := range scopeTypeNames(pkgs) {
+			if T == named.Obj() || isInterface(T.Type()) || isGenericType(T.Type()) {
+				continue
+			}
+			ptr := types.NewPointer(T.Type())
+			if !implements(T.Type(), iface) && !implements(ptr, iface) {
+				continue
+			}
+			if method == nil {
+				found = append(found, T)
+			} else if sel := types.NewMethodSet(ptr).Lookup(method.Pkg(), method.Name()); sel != nil {
+				found = append(found, sel.Obj())
+			}
+		}
+	} else {
+		ptr := types.NewPointer(named)
+		for _, I := range scopeTypeNames(pkgs) {
+			iface, ok := I.Type().Underlying().(*types.Interface)
+			if !ok || iface.NumMethods() == 0 || I == named.Obj() {
+				continue
+			}
+			if !implements(named, iface) && !implements(ptr, iface) {
+				continue
+			}
+			if method == nil {
+				found = append(found, I)
+			} else if m, _ := w.lookupNamedMethod(I.Type().(*types.Named), method.Name()); m != nil {
+				found = append(found, m)
+			}
+		}
+	}
+	return found, nil
+}
+
+// implementsPackages returns the packages searched for implementations: the
+// current package and the packages it imports, and with UsageAll the packages
+// of the module and GOPATH found by the usages walk.
+func (w *PkgWalker) implementsPackages(conf *PkgConfig, defPkg *types.Package) (pkgs []*types.Package) {
+	seen := make(map[string]bool)
+	add := func(pkg *types.Package) {
+		if pkg == nil || seen[pkg.Path()] {
+			return
+		}
+		seen[pkg.Path()] = true
+		pkgs = append(pkgs, pkg)
+	}
+	add(conf.Pkg)
+	add(conf.XPkg)
+	var imported []string
+	for name := range w.Imported {
+		imported = append(imported, name)
+	}
+	sort.Strings(imported)
+	for _, name := range imported {
+		add(w.Imported[name])
+	}
+	if !w.findMode.UsageAll || defPkg == nil {
+		return
+	}
+	for _, path := range w.lookupUsesPaths(conf, ObjNone, defPkg, defPkg.Path(), nil) {
+		pkg, _, _ := w.Import("", path, NewPkgConfig(true, false), nil)
+		add(pkg)
+	}
+	return
+}
+
+// searchPackage is a type-checked package searched for the uses of objects.
+type searchPackage struct {
+	pkg   *types.Package
+	info  *types.Info
+	files map[string]*ast.File
+}
+
+// searchPackages returns the current package, the packages declaring the
+// targets and, with UsageAll, the packages found by the usages walk. GOROOT
+// packages are skipped.
+func (w *PkgWalker) searchPackages(conf *PkgConfig, targets []types.Object) (list []*searchPackage) {
+	seen := make(map[*types.Info]bool)
+	add := func(conf *PkgConfig) {
+		if conf == nil {
+			return
+		}
+		if conf.Pkg != nil && conf.Info != nil && !seen[conf.Info] {
+			seen[conf.Info] = true
+			list = append(list, &searchPackage{conf.Pkg, conf.Info, conf.Files})
+		}
+		if conf.XPkg != nil && conf.XInfo != nil && !seen[conf.XInfo] {
+			seen[conf.XInfo] = true
+			list = append(list, &searchPackage{conf.XPkg, conf.XInfo, conf.XTestFiles})
+		}
+	}
+	add(conf)
+
+	var paths []string
+	for _, obj := range targets {
+		path := obj.Pkg().Path()
+		if IsSamePkg(obj.Pkg(), conf.Pkg) || IsSamePkg(obj.Pkg(), conf.XPkg) || contains(paths, path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if w.findMode.UsageAll {
+		for _, obj := range targets {
+			for _, path := range w.lookupUsesPaths(conf, ObjNone, obj.Pkg(), obj.Pkg().Path(), nil) {
+				if !contains(paths, path) {
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	for _, path := range paths {
+		pkg, pkgConf, _ := w.Import("", path, NewPkgConfig(false, !typesSkipTests), nil)
+		if pkg == nil || IsSamePkg(pkg, conf.Pkg) {
+			continue
+		}
+		if bp, err := w.importPath(conf.Bpkg.Dir, pkg.Path(), build.FindOnly); err == nil && bp.Goroot {
+			continue
+		}
+		add(pkgConf)
+	}
+	return
+}
+
+// sourcePos returns the position of obj in w.FileSet. Objects of packages
+// imported from binary export data are looked up in their source.
+func (w *PkgWalker) sourcePos(obj types.Object) token.Pos {
+	pkg := obj.Pkg()
+	if pkg == nil || !w.fromExportData(pkg) {
+		return obj.Pos()
+	}
+	if _, ok := w.ImportedFilesCheck[pkg.Path()]; ok && w.Imported[pkg.Path()] == pkg {
+		return obj.Pos()
+	}
+	src, _, _ := w.Import("", pkg.Path(), NewPkgConfig(true, false), nil)
+	if src == nil {
+		return obj.Pos()
+	}
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		if t := src.Scope().Lookup(obj.Name()); t != nil {
+			return t.Pos()
+		}
+	case *types.Func:
+		if named, _, ok := parserMethod(obj); ok {
+			if t, ok := src.Scope().Lookup(named.Obj().Name()).(*types.TypeName); ok {
+				if named, ok := t.Type().(*types.Named); ok {
+					if m, _ := w.lookupNamedMethod(named, obj.Name()); m != nil {
+						return m.Pos()
+					}
+				}
+			}
+		} else if t := src.Scope().Lookup(obj.Name()); t != nil {
+			return t.Pos()
+		}
+	}
+	return obj.Pos()
+}
+
+func scopeTypeNames(pkgs []*types.Package) (list []*types.TypeName) {
+	for _, pkg := range pkgs {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			if t, ok := scope.Lookup(name).(*types.TypeName); ok && !t.IsAlias() {
+				list = append(list, t)
+			}
+		}
+	}
+	return
+}
+
+func isInterface(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Interface)
+	return ok
+}
+
+// implements reports whether typ implements iface. Packages are checked
+// one at a time, so the same named type may have several identities and the
+// method signatures are compared by their package qualified strings.
+func implements(typ types.Type, iface *types.Interface) bool {
+	if types.Implements(typ, iface) {
+		return true
+	}
+	ms := types.NewMethodSet(typ)
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		sel := ms.Lookup(m.Pkg(), m.Name())
+		if sel == nil {
+			return false
+		}
+		if typeString(sel.Obj().Type()) != typeString(m.Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+func typeString(typ types.Type) string {
+	return types.TypeString(typ, func(pkg *types.Package) string {
+		return pkg.Path()
+	})
+}
@@ -0,0 +1,271 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Layout is the memory layout of a struct type.
+type Layout struct {
+	Name        string         `json:"name"`
+	GOARCH      string         `json:"goarch"`
+	Size        int64          `json:"size"`
+	Align       int64          `json:"align"`
+	Padding     int64          `json:"padding"`
+	Fields      []*FieldLayout `json:"fields"`
+	Optimal     []string       `json:"optimal,omitempty"`
+	OptimalSize int64          `json:"optimalSize,omitempty"`
+}
+
+// FieldLayout is the memory layout of a struct field. Padding is the number
+// of bytes following the field.
+type FieldLayout struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Offset  int64  `json:"offset"`
+	Size    int64  `json:"size"`
+	Align   int64  `json:"align"`
+	Padding int64  `json:"padding"`
+}
+
+// LookupLayout prints the offset, size, alignment and padding of the fields
+// of the struct type of obj for the GOARCH of the find mode, and the field
+// order of minimal size. With Write the fields of the type declaration are
+// reordered.
+func (w *PkgWalker) LookupLayout(conf *PkgConfig, obj types.Object) error {
+	goarch := w.findMode.GOARCH
+	if goarch == "" {
+		goarch = w.Context.GOARCH
+	}
+	sizes := types.SizesFor("gc", goarch)
+	if sizes == nil {
+		return fmt.Errorf("unknown GOARCH %v", goarch)
+	}
+	typ := obj.Type()
+	if _, ok := obj.(*types.TypeName); !ok {
+		typ = orgType(typ)
+	}
+	st, ok := typ.Underlying().(*types.Struct)
+	if !ok {
+		return fmt.Errorf("%v is not a struct type", obj.Name())
+	}
+	if isGenericType(typ) {
+		return fmt.Errorf("%v is a generic type", obj.Name())
+	}
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, obj.Pkg()) {
+			return ""
+		}
+		return p.Name()
+	}
+	name := types.TypeString(typ, qualifier)
+	if _, ok := typ.(*types.Named); !ok {
+		name = obj.Name()
+	}
+
+	var fields []*types.Var
+	for i := 0; i < st.NumFields(); i++ {
+		fields = append(fields, st.Field(i))
+	}
+	layout := &Layout{Name: name, GOARCH: goarch, Size: sizes.Sizeof(st), Align: sizes.Alignof(st)}
+	offsets := sizes.Offsetsof(fields)
+	for i, f := range fields {
+		fl := &FieldLayout{Name: f.Name(), Type: types.TypeString(f.Type(), qualifier),
+			Offset: offsets[i], Size: sizes.Sizeof(f.Type()), Align: sizes.Alignof(f.Type())}
+		next := layout.Size
+		if i+1 < len(fields) {
+			next = offsets[i+1]
+		}
+		fl.Padding = next - fl.Offset - fl.Size
+		layout.Padding += fl.Padding
+		layout.Fields = append(layout.Fields, fl)
+	}
+
+	order := optimalOrder(fields, sizes)
+	optimal := make([]*types.Var, len(order))
+	for i, n := range order {
+		optimal[i] = fields[n]
+	}
+	optimalSize := sizes.Sizeof(types.NewStruct(optimal, nil))
+	if optimalSize < layout.Size {
+		layout.OptimalSize = optimalSize
+		for _, f := range optimal {
+			layout.Optimal = append(layout.Optimal, f.Name())
+		}
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("%v: size %v, align %v, padding %v (%v)", layout.Name, layout.Size, layout.Align, layout.Padding, goarch))
+	for _, f := range layout.Fields {
+		lines = append(lines, fmt.Sprintf("\t%v %v: offset %v, size %v, align %v, padding %v", f.Name, f.Type, f.Offset, f.Size, f.Align, f.Padding))
+	}
+	if layout.Optimal != nil {
+		lines = append(lines, fmt.Sprintf("optimal order: %v: size %v", strings.Join(layout.Optimal, ", "), layout.OptimalSize))
+	}
+	w.cmd.PrintResult(layout, strings.Join(lines, "\n"))
+
+	if w.findMode.Write && layout.Optimal != nil {
+		named, ok := typ.(*types.Named)
+		if !ok || named.Obj().Pkg() == nil {
+			return fmt.Errorf("cannot reorder fields of %v", name)
+		}
+		if bp, err := w.importPath(conf.Bpkg.Dir, named.Obj().Pkg().Path(), build.FindOnly); err == nil && bp.Goroot {
+			return fmt.Errorf("cannot reorder fields of GOROOT type %v", name)
+		}
+		return w.writeLayout(named.Obj(), order)
+	}
+	return nil
+}
+
+// optimalOrder returns the field indexes of the struct of fields sorted by
+// decreasing alignment and size, with zero-sized fields first so a trailing
+// zero-sized field does not add padding.
+func optimalOrder(fields []*types.Var, sizes types.Sizes) []int {
+	order := make([]int, len(fields))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		fi, fj := fields[order[i]].Type(), fields[order[j]].Type()
+		si, sj := sizes.Sizeof(fi), sizes.Sizeof(fj)
+		if (si == 0) != (sj == 0) {
+			return si == 0
+		}
+		if ai, aj := sizes.Alignof(fi), sizes.Alignof(fj); ai != aj {
+			return ai > aj
+		}
+		return si > sj
+	})
+	return order
+}
+
+// writeLayout rewrites the struct type of the named type obj with the
+// fields in order. The fields declared together, as a, b int, stay declared
+// together while they are next to each other in order and are split at the
+// fields put between them, with the comments kept on the first part; the rest
+// of the file is not changed.
+func (w *PkgWalker) writeLayout(obj types.Object, order []int) error {
+	pos := w.FileSet.Position(obj.Pos())
+	filename := pos.Filename
+	var src []byte
+	if sd, ok := w.fileSourceData[filename]; ok {
+		src = sd.data
+	} else {
+		var err error
+		if src, err = ioutil.ReadFile(filename); err != nil {
+			return err
+		}
+	}
+	// parse again with comments to keep the field comments
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	var spec *ast.TypeSpec
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ts, ok := n.(*ast.TypeSpec); ok && fset.Position(ts.Name.Pos()).Offset == pos.Offset {
+			spec = ts
+		}
+		return spec == nil
+	})
+	if spec == nil {
+		return fmt.Errorf("not found declaration of %v", obj.Name())
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return fmt.Errorf("%v is not declared as a struct", obj.Name())
+	}
+	base := fset.File(file.Pos()).Base()
+	text := func(node ast.Node) string {
+		return string(src[int(node.Pos())-base : int(node.End())-base])
+	}
+
+	attached := make(map[*ast.CommentGroup]bool)
+	var fieldOf []int   // the index in st.Fields.List of each struct field
+	var nameOf []string // the name of each struct field, "" if embedded
+	for i, f := range st.Fields.List {
+		attached[f.Doc] = true
+		attached[f.Comment] = true
+		if len(f.Names) == 0 {
+			fieldOf = append(fieldOf, i)
+			nameOf = append(nameOf, "")
+		}
+		for _, id := range f.Names {
+			fieldOf = append(fieldOf, i)
+			nameOf = append(nameOf, id.Name)
+		}
+	}
+	for _, group := range file.Comments {
+		if group.Pos() > st.Pos() && group.End() < st.End() && !attached[group] {
+			return fmt.Errorf("cannot reorder fields of %v with free-floating comments", obj.Name())
+		}
+	}
+	if len(fieldOf) != len(order) {
+		return fmt.Errorf("cannot reorder fields of %v", obj.Name())
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("package p\n\ntype _ struct {\n")
+	written := make(map[int]bool)
+	for k := 0; k < len(order); {
+		i := fieldOf[order[k]]
+		var names []string
+		for ; k < len(order) && fieldOf[order[k]] == i; k++ {
+			names = append(names, nameOf[order[k]])
+		}
+		f := st.Fields.List[i]
+		if f.Doc != nil && !written[i] {
+			buf.WriteString(text(f.Doc) + "\n")
+		}
+		buf.WriteString(strings.TrimSpace(strings.Join(names, ", ") + " " + text(f.Type)))
+		if f.Tag != nil {
+			buf.WriteString(" " + f.Tag.Value)
+		}
+		if f.Comment != nil && !written[i] {
+			buf.WriteString(" " + text(f.Comment))
+		}
+		buf.WriteString("\n")
+		written[i] = true
+	}
+	buf.WriteString("}\n")
+	data, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	structText := strings.TrimRight(string(data[bytes.Index(data, []byte("struct {")):]), "\n")
+	// indent the fields as the line of the struct type
+	start := int(st.Pos()) - base
+	line := src[bytes.LastIndexByte(src[:start], '\n')+1 : start]
+	indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+	structText = strings.Replace(structText, "\n", "\n"+string(indent), -1)
+
+	buf.Reset()
+	buf.Write(src[:start])
+	buf.WriteString(structText)
+	buf.Write(src[int(st.End())-base:])
+	data = buf.Bytes()
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, data, info.Mode()); err != nil {
+		return err
+	}
+	InvalidateCache(filename)
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// MethodSet is the method sets of a named type T and of *T, and the tree
+// of the types embedded in T.
+type MethodSet struct {
+	Name     string          `json:"name"`
+	Value    []*MethodInfo   `json:"value"`
+	Pointer  []*MethodInfo   `json:"pointer"`
+	Embedded []*EmbeddedType `json:"embedded,omitempty"`
+}
+
+// MethodInfo is a method of a method set. Via is the path of the embedded
+// types a promoted method is found through.
+type MethodInfo struct {
+	Name      string   `json:"name"`
+	Signature string   `json:"signature"`
+	Promoted  bool     `json:"promoted"`
+	Via       []string `json:"via,omitempty"`
+	Filename  string   `json:"filename,omitempty"`
+	Line      int      `json:"line,omitempty"`
+	Column    int      `json:"column,omitempty"`
+}
+
+// EmbeddedType is an embedded field of a struct or an embedded interface,
+// and the types embedded in it.
+type EmbeddedType struct {
+	Name     string          `json:"name"`
+	Filename string          `json:"filename,omitempty"`
+	Line     int             `json:"line,omitempty"`
+	Column   int             `json:"column,omitempty"`
+	Embedded []*EmbeddedType `json:"embedded,omitempty"`
+}
+
+// LookupMethodSet prints the method sets of the named type of obj and of its
+// pointer type, each method declared or promoted via the embedded types,
+// and the tree of the embedded fields or embedded interfaces.
+func (w *PkgWalker) LookupMethodSet(conf *PkgConfig, obj types.Object) error {
+	typ := obj.Type()
+	if _, ok := obj.(*types.TypeName); !ok {
+		typ = orgType(typ)
+	}
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return fmt.Errorf("%v is not a named type", obj.Name())
+	}
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, named.Obj().Pkg()) {
+			return ""
+		}
+		return p.Name()
+	}
+	ms := &MethodSet{Name: types.TypeString(named, qualifier)}
+	ms.Value = w.methodSetInfo(named, named, qualifier)
+	if !isInterface(named) {
+		ms.Pointer = w.methodSetInfo(types.NewPointer(named), named, qualifier)
+	}
+	ms.Embedded = w.embeddedTypes(named, qualifier, map[*types.Named]bool{named: true})
+
+	var lines []string
+	print := func(name string, list []*MethodInfo) {
+		lines = append(lines, "methodset "+name)
+		for _, m := range list {
+			text := fmt.Sprintf("\t%v%v declared", m.Name, m.Signature)
+			if m.Promoted {
+				text = fmt.Sprintf("\t%v%v promoted via %v", m.Name, m.Signature, strings.Join(m.Via, " > "))
+			}
+			if m.Filename != "" {
+				text += " " + token.Position{Filename: m.Filename, Line: m.Line, Column: m.Column}.String()
+			}
+			lines = append(lines, text)
+		}
+	}
+	print(ms.Name, ms.Value)
+	if !isInterface(named) {
+		print("*"+ms.Name, ms.Pointer)
+	}
+	if len(ms.Embedded) > 0 {
+		lines = append(lines, "embedded "+ms.Name)
+		var tree func(list []*EmbeddedType, indent string)
+		tree = func(list []*EmbeddedType, indent string) {
+			for _, e := range list {
+				text := indent + e.Name
+				if e.Filename != "" {
+					text += " " + token.Position{Filename: e.Filename, Line: e.Line, Column: e.Column}.String()
+				}
+				lines = append(lines, text)
+				tree(e.Embedded, indent+"\t")
+			}
+		}
+		tree(ms.Embedded, "\t")
+	}
+	w.cmd.PrintResult(ms, strings.Join(lines, "\n"))
+	return nil
+}
+
+// methodSetInfo returns the methods of the method set of typ, the named
+// type or its pointer type, without the unexported methods of other packages.
+func (w *PkgWalker) methodSetInfo(typ types.Type, named *types.Named, qualifier types.Qualifier) (list []*MethodInfo) {
+	mset := types.NewMethodSet(typ)
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+		fn := sel.Obj().(*types.Func)
+		if !fn.Exported() && !IsSamePkg(fn.Pkg(), named.Obj().Pkg()) {
+			continue
+		}
+		sig := types.TypeString(fn.Type(), qualifier)
+		m := &MethodInfo{Name: fn.Name(), Signature: strings.TrimPrefix(sig, "func")}
+		if iface, ok := named.Underlying().(*types.Interface); ok {
+			m.Via = interfacePath(iface, fn, qualifier)
+		} else {
+			m.Via = embeddingPath(named, sel.Index(), qualifier)
+		}
+		m.Promoted = len(m.Via) > 0
+		pos := w.position(w.sourcePos(fn))
+		if pos.IsValid() {
+			m.Filename, m.Line, m.Column = pos.Filename, pos.Line, pos.Column
+		}
+		list = append(list, m)
+	}
+	return
+}
+
+// embeddingPath returns the types of the embedded fields of the selection
+// index path of a method of named.
+func embeddingPath(named *types.Named, index []int, qualifier types.Qualifier) (path []string) {
+	var typ types.Type = named
+	for _, i := range index[:len(index)-1] {
+		st, ok := orgType(typ).Underlying().(*types.Struct)
+		if !ok || i >= st.NumFields() {
+			break
+		}
+		typ = st.Field(i).Type()
+		path = append(path, types.TypeString(orgType(typ), qualifier))
+	}
+	return
+}
+
+// interfacePath returns the embedded interfaces of iface the method fn is
+// found through, or nil if iface declares it.
+func interfacePath(iface *types.Interface, fn *types.Func, qualifier types.Qualifier) []string {
+	for i := 0; i < iface.NumExplicitMethods(); i++ {
+		if iface.ExplicitMethod(i) == fn {
+			return nil
+		}
+	}
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		typ := iface.EmbeddedType(i)
+		embedded, ok := typ.Underlying().(*types.Interface)
+		if !ok || !hasMethod(embedded, fn) {
+			continue
+		}
+		return append([]string{types.TypeString(typ, qualifier)}, interfacePath(embedded, fn, qualifier)...)
+	}
+	return nil
+}
+
+func hasMethod(iface *types.Interface, fn *types.Func) bool {
+	for i := 0; i < iface.NumMethods(); i++ {
+		if iface.Method(i) == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedTypes returns the tree of the embedded fields of the struct type
+// or of the embedded interfaces of the interface type named.
+func (w *PkgWalker) embeddedTypes(named *types.Named, qualifier types.Qualifier, seen map[*types.Named]bool) (list []*EmbeddedType) {
+	var embedded []types.Type
+	switch t := named.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if f := t.Field(i); f.Anonymous() {
+				embedded = append(embedded, f.Type())
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			embedded = append(embedded, t.EmbeddedType(i))
+		}
+	}
+	for _, typ := range embedded {
+		e := &EmbeddedType{Name: types.TypeString(typ, qualifier)}
+		if n, ok := orgType(typ).(*types.Named); ok {
+			if pos := w.position(w.sourcePos(n.Obj())); pos.IsValid() {
+				e.Filename, e.Line, e.Column = pos.Filename, pos.Line, pos.Column
+			}
+			if !seen[n] {
+				seen[n] = true
+				e.Embedded = w.embeddedTypes(n, qualifier, seen)
+				delete(seen, n)
+			}
+		}
+		list = append(list, e)
+	}
+	return
+}
@@ -0,0 +1,214 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GenerateMock returns the source of a file of the package pkgName with a
+// mock of the interface iface named name, by default Mock and the name of
+// the interface. The interface is looked up as by ImplementStubs for the
+// package of conf in dir, if any, or its external test package if pkgName
+// is the name of it. The mock is in that package if pkgName is empty or its
+// name; otherwise the objects of the package are qualified.
+//
+// For each method M the mock has a field MFunc called by M, the methods
+// ExpectM setting MFunc to return its arguments, MCalls returning the
+// calls recorded with their arguments as NameMCall and MCallCount. The
+// source is the same for the same interface, so it can be regenerated.
+func (w *PkgWalker) GenerateMock(conf *PkgConfig, dir string, iface string, name string, pkgName string) ([]byte, error) {
+	var pkg, local *types.Package
+	if conf != nil {
+		pkg = conf.Pkg
+	}
+	if pkg != nil && (pkgName == "" || pkgName == pkg.Name()) {
+		local, pkgName = pkg, pkg.Name()
+	} else if conf != nil && conf.XPkg != nil && pkgName == conf.XPkg.Name() {
+		pkg, local = conf.XPkg, conf.XPkg
+	}
+	if pkgName == "" {
+		return nil, fmt.Errorf("no package name of the mock")
+	}
+	if pkg == nil {
+		pkg = types.NewPackage("", pkgName)
+	}
+	tn, err := w.lookupInterface(dir, pkg, nil, iface)
+	if err != nil {
+		return nil, err
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a defined interface", iface)
+	}
+	if name == "" {
+		name = "Mock" + tn.Name()
+	}
+
+	// the local names of the imported packages by path, and the paths by
+	// name; the names of the receiver and the locals are reserved
+	imports := map[string]string{"sync": "sync"}
+	paths := map[string]string{"sync": "sync", "m": "", "fn": ""}
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, local) {
+			return ""
+		}
+		if n, ok := imports[p.Path()]; ok {
+			return n
+		}
+		n := p.Name()
+		for i := 2; ; i++ {
+			if _, ok := paths[n]; !ok {
+				break
+			}
+			n = fmt.Sprintf("%v%v", p.Name(), i)
+		}
+		imports[p.Path()], paths[n] = n, p.Path()
+		return n
+	}
+
+	ifaceType := named.Underlying().(*types.Interface)
+	methods := make(map[string]bool)
+	for i := 0; i < ifaceType.NumMethods(); i++ {
+		methods[ifaceType.Method(i).Name()] = true
+	}
+	for i := 0; i < ifaceType.NumMethods(); i++ {
+		m := ifaceType.Method(i)
+		if !m.Exported() && !IsSamePkg(m.Pkg(), local) {
+			return nil, fmt.Errorf("cannot mock unexported method %v of %v", m.Name(), iface)
+		}
+		for _, s := range []string{m.Name() + "Func", "Expect" + m.Name(), m.Name() + "Calls", m.Name() + "CallCount"} {
+			if methods[s] {
+				return nil, fmt.Errorf("mock %v of method %v conflicts with method %v", s, m.Name(), s)
+			}
+		}
+	}
+
+	tparams, targs := typeParamsDecl(named, qualifier), typeParamNames(named)
+	mock := name + targs
+	var fields, body bytes.Buffer
+	for i := 0; i < ifaceType.NumMethods(); i++ {
+		m := ifaceType.Method(i)
+		sig := m.Type().(*types.Signature)
+		call := name + m.Name() + "Call"
+
+		var params, args, types_, callFields, record []string
+		// the declared names are kept unless they hide a name of the body
+		// or one of the argN fallbacks
+		reserved := map[string]bool{"m": true, "fn": true, "append": true, "panic": true, call: true}
+		for j := 0; j < sig.Params().Len(); j++ {
+			reserved[fmt.Sprintf("arg%v", j)] = true
+		}
+		used := make(map[string]bool)
+		for j := 0; j < sig.Params().Len(); j++ {
+			p := sig.Params().At(j)
+			typ := types.TypeString(p.Type(), qualifier)
+			arg := p.Name()
+			if arg == "" || arg == "_" || reserved[arg] {
+				arg = fmt.Sprintf("arg%v", j)
+			}
+			param, pass := typ, arg
+			if sig.Variadic() && j == sig.Params().Len()-1 {
+				param = "..." + types.TypeString(p.Type().(*types.Slice).Elem(), qualifier)
+				pass = arg + "..."
+			}
+			field := exportedName(p.Name())
+			if field == "" || used[field] {
+				field = fmt.Sprintf("Arg%v", j)
+			}
+			used[field] = true
+			params = append(params, arg+" "+param)
+			args = append(args, pass)
+			types_ = append(types_, param)
+			callFields = append(callFields, "\t"+field+" "+typ+"\n")
+			record = append(record, field+": "+arg)
+		}
+		var results, rparams, rnames []string
+		for j := 0; j < sig.Results().Len(); j++ {
+			typ := types.TypeString(sig.Results().At(j).Type(), qualifier)
+			results = append(results, typ)
+			rparams = append(rparams, fmt.Sprintf("r%v %v", j, typ))
+			rnames = append(rnames, fmt.Sprintf("r%v", j))
+		}
+		result := ""
+		switch len(results) {
+		case 0:
+		case 1:
+			result = " " + results[0]
+		default:
+			result = " (" + strings.Join(results, ", ") + ")"
+		}
+		ret := ""
+		if len(results) > 0 {
+			ret = "return "
+		}
+		funcType := "func(" + strings.Join(types_, ", ") + ")" + result
+
+		fmt.Fprintf(&fields, "\t%vFunc %v\n\tcalls%v []%v%v\n", m.Name(), funcType, m.Name(), call, targs)
+
+		if len(callFields) > 0 {
+			callFields = append([]string{"\n"}, callFields...)
+		}
+		fmt.Fprintf(&body, "// %v is a call of %v.%v with its arguments.\ntype %v%v struct{%v}\n\n",
+			call, name, m.Name(), call, tparams, strings.Join(callFields, ""))
+		fmt.Fprintf(&body, "// %v calls %vFunc and records the call.\nfunc (m *%v) %v(%v)%v {\n", m.Name(), m.Name(), mock, m.Name(), strings.Join(params, ", "), result)
+		fmt.Fprintf(&body, "\tm.mu.Lock()\n\tm.calls%v = append(m.calls%v, %v%v{%v})\n\tfn := m.%vFunc\n\tm.mu.Unlock()\n",
+			m.Name(), m.Name(), call, targs, strings.Join(record, ", "), m.Name())
+		fmt.Fprintf(&body, "\tif fn == nil {\n\t\tpanic(\"%v.%v: %vFunc is not set\")\n\t}\n\t%vfn(%v)\n}\n\n",
+			name, m.Name(), m.Name(), ret, strings.Join(args, ", "))
+		fmt.Fprintf(&body, "// Expect%v sets %vFunc to return the results.\nfunc (m *%v) Expect%v(%v) *%v {\n",
+			m.Name(), m.Name(), mock, m.Name(), strings.Join(rparams, ", "), mock)
+		fmt.Fprintf(&body, "\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n\tm.%vFunc = %v {\n\t\t%v%v\n\t}\n\treturn m\n}\n\n",
+			m.Name(), funcType, ret, strings.Join(rnames, ", "))
+		fmt.Fprintf(&body, "// %vCalls returns the recorded calls of %v.\nfunc (m *%v) %vCalls() []%v%v {\n",
+			m.Name(), m.Name(), mock, m.Name(), call, targs)
+		fmt.Fprintf(&body, "\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n\treturn append([]%v%v(nil), m.calls%v...)\n}\n\n", call, targs, m.Name())
+		fmt.Fprintf(&body, "// %vCallCount returns the number of calls of %v.\nfunc (m *%v) %vCallCount() int {\n",
+			m.Name(), m.Name(), mock, m.Name())
+		fmt.Fprintf(&body, "\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n\treturn len(m.calls%v)\n}\n\n", m.Name())
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gotools mock -iface %v; DO NOT EDIT.\n\npackage %v\n\n", iface, pkgName)
+	var list []string
+	for path := range imports {
+		list = append(list, path)
+	}
+	sort.Strings(list)
+	buf.WriteString("import (\n")
+	for _, path := range list {
+		if n := imports[path]; n != path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&buf, "\t%v %q\n", n, path)
+		} else {
+			fmt.Fprintf(&buf, "\t%q\n", path)
+		}
+	}
+	buf.WriteString(")\n\n")
+	ifaceName := tn.Name()
+	if !IsSamePkg(tn.Pkg(), local) {
+		ifaceName = tn.Pkg().Path() + "." + ifaceName
+	}
+	fmt.Fprintf(&buf, "// %v is a mock of the interface %v.\ntype %v%v struct {\n\tmu sync.Mutex\n\n%v}\n\n",
+		name, ifaceName, name, tparams, fields.String())
+	buf.Write(body.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+// exportedName returns name with an upper case first letter, or "" for
+// the blank name.
+func exportedName(name string) string {
+	if name == "" || name == "_" {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
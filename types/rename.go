@@ -0,0 +1,395 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+type renameEdit struct {
+	pos    token.Pos
+	length int
+}
+
+type renameConflict struct {
+	pos token.Pos
+	msg string
+}
+
+// renamer collects the edits and conflicts of renaming a group of objects.
+type renamer struct {
+	w         *PkgWalker
+	newName   string
+	targets   []types.Object
+	edits     map[token.Pos]*renameEdit
+	conflicts []*renameConflict
+}
+
+// LookupRename renames obj to w.findMode.Rename in every package that
+// references it. Methods are renamed together with the interface methods
+// they implement and the other implementations of those interfaces. The
+// edits are printed as file::offset::length::text and with Write they are
+// applied to the files. Nothing is renamed if the new name conflicts with an
+// existing identifier.
+func (w *PkgWalker) LookupRename(conf *PkgConfig, obj types.Object) error {
+	newName := w.findMode.Rename
+	if !token.IsIdentifier(newName) {
+		return fmt.Errorf("invalid identifier %q", newName)
+	}
+	kind, _ := parserObjKind(obj)
+	switch kind {
+	case ObjPackage, ObjPkgName, ObjLabel, ObjBuiltin, ObjNil, ObjNone:
+		return fmt.Errorf("cannot rename %s %s", kind, obj.Name())
+	}
+	if obj.Name() == newName {
+		return fmt.Errorf("%s is already named %s", kind, newName)
+	}
+	if obj.Pkg() == nil {
+		return fmt.Errorf("cannot rename universe %s %s", kind, obj.Name())
+	}
+	if bp, err := w.importPath(conf.Bpkg.Dir, obj.Pkg().Path(), build.FindOnly); err == nil && bp.Goroot {
+		return fmt.Errorf("cannot rename %s %s of GOROOT package %s", kind, obj.Name(), obj.Pkg().Path())
+	}
+	if ast.IsExported(obj.Name()) {
+		w.findMode.UsageAll = true
+	}
+
+	r := &renamer{w: w, newName: newName, edits: make(map[token.Pos]*renameEdit)}
+	r.targets = append(r.targets, obj)
+	if kind == ObjMethod {
+		if err := r.addMethodGroup(conf, obj); err != nil {
+			return err
+		}
+	}
+	for _, p := range w.searchPackages(conf, r.targets) {
+		r.check(p)
+	}
+
+	if len(r.conflicts) > 0 {
+		sort.Slice(r.conflicts, func(i, j int) bool {
+			return r.conflicts[i].pos < r.conflicts[j].pos
+		})
+		for _, c := range r.conflicts {
+			res := w.posResult("conflict", c.pos)
+			res.Text = c.msg
+			w.cmd.PrintResult(res, w.posText(w.positionRange(c.pos))+": "+c.msg)
+		}
+		return fmt.Errorf("rename %s to %s: %d conflicts", obj.Name(), newName, len(r.conflicts))
+	}
+
+	var edits []*renameEdit
+	for _, e := range r.edits {
+		edits = append(edits, e)
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].pos < edits[j].pos
+	})
+	for _, e := range edits {
+		pos := w.position(e.pos)
+		end := w.position(e.pos + token.Pos(e.length))
+		length := end.Offset - pos.Offset
+		res := &Result{Kind: "edit", Filename: pos.Filename, Line: pos.Line, Column: pos.Column,
+			EndLine: end.Line, EndColumn: end.Column, Offset: pos.Offset, Length: length, Text: newName}
+		w.cmd.PrintResult(res, fmt.Sprintf("%s::%d::%d::%s", pos.Filename, pos.Offset, length, newName))
+	}
+	if w.findMode.Write {
+		return w.writeRenameEdits(edits, newName)
+	}
+	return nil
+}
+
+// addMethodGroup adds the interface methods implemented by the method obj and
+// the methods of all implementations of these interfaces.
+func (r *renamer) addMethodGroup(conf *PkgConfig, obj types.Object) error {
+	named, _, ok := parserMethod(obj)
+	if !ok {
+		return nil
+	}
+	ifaces := []types.Object{obj}
+	if !isInterface(named) {
+		found, err := r.w.findImplements(conf, obj)
+		if err != nil {
+			return err
+		}
+		r.add(found...)
+		ifaces = found
+	}
+	for _, m := range ifaces {
+		found, err := r.w.findImplements(conf, m)
+		if err != nil {
+			return err
+		}
+		r.add(found...)
+	}
+	return nil
+}
+
+func (r *renamer) add(objs ...types.Object) {
+	for _, obj := range objs {
+		if !r.isTarget(obj) {
+			r.targets = append(r.targets, obj)
+		}
+	}
+}
+
+// isTarget reports whether obj is one of the renamed objects. Packages may be
+// checked more than once, so objects are compared by IsSameObject and objects
+// of instantiated types and type switch cases by their declaration.
+func (r *renamer) isTarget(obj types.Object) bool {
+	if obj == nil {
+		return false
+	}
+	for _, t := range r.targets {
+		if obj.Name() != t.Name() {
+			continue
+		}
+		kind, _ := parserObjKind(t)
+		if IsSameObject(obj, t, kind) || (obj.Pos() == t.Pos() && IsSamePkg(obj.Pkg(), t.Pkg())) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmbeddedTarget reports whether obj is an embedded field of a renamed type.
+func (r *renamer) isEmbeddedTarget(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	if !ok || !v.Anonymous() {
+		return false
+	}
+	if named, ok := orgType(v.Type()).(*types.Named); ok {
+		return r.isTarget(named.Obj())
+	}
+	return false
+}
+
+// check collects the edits of p and the conflicts of the new name in p.
+func (r *renamer) check(p *searchPackage) {
+	selectors := make(map[*ast.Ident]*types.Selection)
+	for expr, sel := range p.info.Selections {
+		selectors[expr.Sel] = sel
+	}
+	for id, obj := range p.info.Defs {
+		if obj == nil {
+			// the symbolic variable of a type switch
+			for _, t := range r.targets {
+				if id.Pos() == t.Pos() && id.Name == t.Name() {
+					r.addEdit(id)
+				}
+			}
+			continue
+		}
+		if r.isTarget(obj) {
+			r.addEdit(id)
+			r.checkDecl(p, id, obj)
+		}
+	}
+	for id, obj := range p.info.Uses {
+		if r.isTarget(obj) || r.isEmbeddedTarget(obj) {
+			r.addEdit(id)
+			if !IsSamePkg(p.pkg, obj.Pkg()) && !ast.IsExported(r.newName) {
+				r.conflict(id.Pos(), "%s is used by package %s, %s would be unexported", obj.Name(), p.pkg.Path(), r.newName)
+			}
+			if sel, ok := selectors[id]; ok {
+				r.checkSelection(p, id, sel)
+			} else if obj.Parent() != nil && IsSamePkg(p.pkg, obj.Pkg()) {
+				r.checkUse(p, id, obj)
+			}
+		} else if id.Name == r.newName {
+			r.checkShadow(p, id, obj)
+		}
+	}
+}
+
+func (r *renamer) addEdit(id *ast.Ident) {
+	r.edits[id.Pos()] = &renameEdit{pos: id.Pos(), length: len(id.Name)}
+}
+
+func (r *renamer) conflict(pos token.Pos, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for _, c := range r.conflicts {
+		if c.pos == pos && c.msg == msg {
+			return
+		}
+	}
+	r.conflicts = append(r.conflicts, &renameConflict{pos, msg})
+}
+
+func (r *renamer) objString(obj types.Object) string {
+	kind, _ := parserObjKind(obj)
+	if !obj.Pos().IsValid() {
+		return fmt.Sprintf("%s %s", kind, obj.Name())
+	}
+	return fmt.Sprintf("%s %s declared at %s", kind, obj.Name(), r.w.FileSet.Position(obj.Pos()))
+}
+
+// checkDecl checks that the new name is free in the scope of the declaration
+// of obj, or in the field and method set of its type.
+func (r *renamer) checkDecl(p *searchPackage, id *ast.Ident, obj types.Object) {
+	var owners []*types.Named
+	switch obj := obj.(type) {
+	case *types.Func:
+		if named, _, ok := parserMethod(obj); ok {
+			owners = append(owners, named)
+		}
+	case *types.Var:
+		if obj.IsField() {
+			owners = fieldOwners(p.info, obj)
+		}
+	}
+	for _, named := range owners {
+		if other, _, _ := types.LookupFieldOrMethod(named, true, obj.Pkg(), r.newName); other != nil && !r.isTarget(other) {
+			r.conflict(id.Pos(), "%s already has %s", named.Obj().Name(), r.objString(other))
+		}
+	}
+	scope := obj.Parent()
+	if scope == nil {
+		return
+	}
+	if other := scope.Lookup(r.newName); other != nil && !r.isTarget(other) {
+		r.conflict(id.Pos(), "%s %s conflicts with %s", obj.Name(), r.newName, r.objString(other))
+	}
+	if scope == obj.Pkg().Scope() {
+		for _, f := range p.files {
+			if s := p.info.Scopes[f]; s != nil {
+				if other := s.Lookup(r.newName); other != nil {
+					r.conflict(id.Pos(), "%s %s conflicts with %s", obj.Name(), r.newName, r.objString(other))
+				}
+			}
+		}
+	}
+}
+
+// checkUse checks that the renamed identifier id still refers to obj and is
+// not shadowed by a declaration of the new name in an inner scope.
+func (r *renamer) checkUse(p *searchPackage, id *ast.Ident, obj types.Object) {
+	scope := r.innermostScope(p, id.Pos())
+	if scope == nil {
+		return
+	}
+	s, other := scope.LookupParent(r.newName, id.Pos())
+	if other == nil || r.isTarget(other) || s == obj.Parent() {
+		return
+	}
+	for ; s != nil; s = s.Parent() {
+		if s == obj.Parent() {
+			r.conflict(id.Pos(), "%s would be shadowed by %s", r.newName, r.objString(other))
+			return
+		}
+	}
+}
+
+// checkSelection checks that the renamed selector id still selects the
+// renamed field or method.
+func (r *renamer) checkSelection(p *searchPackage, id *ast.Ident, sel *types.Selection) {
+	other, _, _ := types.LookupFieldOrMethod(sel.Recv(), true, p.pkg, r.newName)
+	if other != nil && !r.isTarget(other) {
+		r.conflict(id.Pos(), "%s would select %s", r.newName, r.objString(other))
+	}
+}
+
+// checkShadow checks that id, an identifier already named the new name, is
+// not captured by a renamed object declared in an inner scope.
+func (r *renamer) checkShadow(p *searchPackage, id *ast.Ident, obj types.Object) {
+	if obj == nil || obj.Parent() == nil {
+		return
+	}
+	scope := r.innermostScope(p, id.Pos())
+	for s := scope; s != nil && s != obj.Parent(); s = s.Parent() {
+		for _, t := range r.targets {
+			if t.Parent() != s || !IsSamePkg(t.Pkg(), p.pkg) {
+				continue
+			}
+			if s != t.Pkg().Scope() && id.Pos() < t.Pos() {
+				continue
+			}
+			r.conflict(id.Pos(), "%s would be shadowed by renamed %s", r.objString(obj), r.objString(t))
+		}
+	}
+}
+
+func (r *renamer) innermostScope(p *searchPackage, pos token.Pos) *types.Scope {
+	tf := r.w.FileSet.File(pos)
+	for _, f := range p.files {
+		if r.w.FileSet.File(f.Pos()) == tf {
+			if s := p.info.Scopes[f]; s != nil {
+				return findScope(s, pos)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldOwners returns the named struct types declared in info with field v.
+func fieldOwners(info *types.Info, v *types.Var) (owners []*types.Named) {
+	for _, obj := range info.Defs {
+		t, ok := obj.(*types.TypeName)
+		if !ok {
+			continue
+		}
+		named, ok := t.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+		if st, ok := named.Underlying().(*types.Struct); ok {
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i) == v {
+					owners = append(owners, named)
+				}
+			}
+		}
+	}
+	return
+}
+
+// writeRenameEdits replaces the identifiers of edits by newName.
+func (w *PkgWalker) writeRenameEdits(edits []*renameEdit, newName string) error {
+	files := make(map[string][]*renameEdit)
+	var names []string
+	for _, e := range edits {
+		filename := w.FileSet.Position(e.pos).Filename
+		if _, ok := files[filename]; !ok {
+			names = append(names, filename)
+		}
+		files[filename] = append(files[filename], e)
+	}
+	for _, filename := range names {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if sd, ok := w.fileSourceData[filename]; ok {
+			data = sd.data
+		} else if data, err = ioutil.ReadFile(filename); err != nil {
+			return err
+		}
+		list := files[filename]
+		var out []byte
+		last := 0
+		for _, e := range list {
+			offset := w.FileSet.Position(e.pos).Offset
+			if offset < last || offset+e.length > len(data) {
+				return fmt.Errorf("%s: invalid edit offset %d", filename, offset)
+			}
+			out = append(out, data[last:offset]...)
+			out = append(out, newName...)
+			last = offset + e.length
+		}
+		out = append(out, data[last:]...)
+		if err := ioutil.WriteFile(filename, out, info.Mode()); err != nil {
+			return err
+		}
+	}
+	InvalidateCache(names...)
+	return nil
+}
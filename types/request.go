@@ -0,0 +1,92 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/command"
+)
+
+// Request is the setup of a command that checks a package with the unsaved
+// sources of an editor. Close must be called when the request finishes.
+type Request struct {
+	Tags    string // space-separated build tags
+	Overlay string // txtar archive or json map of unsaved sources, - for stdin
+	Stdin   bool   // read the source of the file of the request from stdin
+
+	w       *PkgWalker
+	src     []byte
+	overlay bool
+}
+
+// Walker loads the overlay and the source of filename from stdin and
+// returns the walker of the build context with the tags with their source
+// data.
+func (r *Request) Walker(cmd *command.Command, filename string) (*PkgWalker, error) {
+	var overlay buildctx.Overlay
+	if r.Overlay != "" {
+		if r.Overlay == "-" && r.Stdin {
+			return nil, fmt.Errorf("-overlay - and -stdin both read stdin")
+		}
+		var err error
+		if overlay, err = buildctx.LoadOverlay(r.Overlay, cmd.Stdin); err != nil {
+			return nil, err
+		}
+		r.overlay = true
+	}
+	if r.Stdin {
+		src, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.src = src
+	}
+	context := buildctx.System()
+	if r.Tags != "" {
+		context.BuildTags = append(strings.Split(r.Tags, " "), context.BuildTags...)
+	}
+	w := LookupPkgWalker(context)
+	w.SetOutput(cmd.Stdout, cmd.Stderr)
+	for name, data := range overlay {
+		if data != nil {
+			w.UpdateSourceData(name, data, false)
+		}
+	}
+	if r.src != nil {
+		w.UpdateSourceData(filename, r.src, false)
+	}
+	r.w = w
+	return w, nil
+}
+
+// Cursor returns the cursor at offset of filename, with the source read
+// from stdin.
+func (r *Request) Cursor(filename string, offset int) *FileCursor {
+	dir, name := filepath.Split(filename)
+	return NewFileCursor(r.src, filepath.Clean(dir), name, offset)
+}
+
+// Check type-checks the package in dir with its test files.
+func (r *Request) Check(dir string, cursor *FileCursor) (*types.Package, *PkgConfig, error) {
+	return r.w.Check(dir, NewPkgConfig(false, true), cursor)
+}
+
+// Close drops the source data of the request from the walker and the
+// overlay from the build context.
+func (r *Request) Close() {
+	if r.w != nil {
+		r.w.ClearSourceData()
+	}
+	if r.overlay {
+		buildctx.SetOverlay(nil)
+	}
+}
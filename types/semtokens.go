@@ -0,0 +1,305 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/pkg/stdlib"
+)
+
+// SemanticToken is the range of an identifier with the LSP semantic token
+// type and modifiers of the object it denotes.
+type SemanticToken struct {
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	Length    int      `json:"length"`
+	Type      string   `json:"type"`
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+// semanticTokenTypes are the token types of the object kinds.
+var semanticTokenTypes = map[ObjKind]string{
+	ObjPackage:    "namespace",
+	ObjPkgName:    "namespace",
+	ObjTypeName:   "type",
+	ObjInterface:  "interface",
+	ObjStruct:     "struct",
+	ObjConst:      "variable",
+	ObjVar:        "variable",
+	ObjField:      "property",
+	ObjFunc:       "function",
+	ObjMethod:     "method",
+	ObjLabel:      "label",
+	ObjBuiltin:    "function",
+	ObjNil:        "variable",
+	ObjImplicit:   "variable",
+	ObjTypeParam:  "typeParameter",
+	ObjConstraint: "interface",
+}
+
+// LookupSemanticTokens returns the semantic tokens of the identifiers of the
+// cursor file in source order. Parameters and results are of the type
+// parameter. The modifiers are definition, readonly for consts and nil,
+// deprecated for objects documented as deprecated and defaultLibrary for
+// the objects of the standard library and the universe.
+func (w *PkgWalker) LookupSemanticTokens(conf *PkgConfig, cursor *FileCursor) ([]*SemanticToken, error) {
+	pkg, info := conf.Pkg, conf.Info
+	if cursor.xtest {
+		pkg, info = conf.XPkg, conf.XInfo
+	}
+	file, _ := w.parseFile(cursor.fileDir, cursor.fileName)
+	if file == nil || pkg == nil {
+		return nil, os.ErrNotExist
+	}
+	params := make(map[types.Object]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		var lists []*ast.FieldList
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			lists = append(lists, n.Recv)
+		case *ast.FuncType:
+			lists = append(lists, n.Params, n.Results)
+		}
+		for _, list := range lists {
+			if list == nil {
+				continue
+			}
+			for _, field := range list.List {
+				for _, id := range field.Names {
+					if obj := info.Defs[id]; obj != nil {
+						params[obj] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	d := &deprecations{w: w, dir: cursor.fileDir, local: []*types.Package{conf.Pkg, conf.XPkg}, pkgs: make(map[string]map[string]bool)}
+	var list []*SemanticToken
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || id.Name == "_" {
+			return true
+		}
+		var kind ObjKind
+		var mods []string
+		obj, ok := info.Uses[id]
+		if !ok {
+			obj, ok = info.Defs[id]
+			if !ok {
+				return true
+			}
+			mods = append(mods, "definition")
+		}
+		if obj == nil {
+			if id == file.Name {
+				kind = ObjPackage
+			} else {
+				kind = ObjImplicit
+			}
+		} else {
+			kind, _ = parserObjKind(obj)
+		}
+		typ, ok := semanticTokenTypes[kind]
+		if !ok {
+			return true
+		}
+		if params[obj] {
+			typ = "parameter"
+		}
+		if kind == ObjConst || kind == ObjNil {
+			mods = append(mods, "readonly")
+		}
+		if obj != nil && d.deprecated(obj) {
+			mods = append(mods, "deprecated")
+		}
+		if obj != nil && isDefaultLibrary(obj) {
+			mods = append(mods, "defaultLibrary")
+		}
+		pos := w.position(id.Pos())
+		list = append(list, &SemanticToken{Line: pos.Line, Column: pos.Column,
+			Length: srcpos.Count([]byte(id.Name), w.PosEncoding), Type: typ, Modifiers: mods})
+		return true
+	})
+	return list, nil
+}
+
+// deprecations finds the package level objects, methods and fields whose
+// doc comment has a paragraph starting with "Deprecated: ". The sources of
+// a package are parsed once.
+type deprecations struct {
+	w     *PkgWalker
+	dir   string           // directory of the local packages
+	local []*types.Package // packages of the cursor file and its external tests
+	pkgs  map[string]map[string]bool
+}
+
+func (d *deprecations) deprecated(obj types.Object) bool {
+	pkg := obj.Pkg()
+	if pkg == nil {
+		return false
+	}
+	var key string
+	switch obj := obj.(type) {
+	case *types.Func:
+		key = obj.Name()
+		if named, _, ok := parserMethod(obj); ok {
+			key = named.Obj().Name() + "." + key
+		}
+	case *types.Var:
+		if !obj.IsField() {
+			key = obj.Name()
+			break
+		}
+		key = fieldKey(obj)
+	default:
+		key = obj.Name()
+	}
+	if key == "" || (obj.Parent() != nil && obj.Parent() != pkg.Scope()) {
+		return false
+	}
+	set, ok := d.pkgs[pkg.Path()]
+	if !ok {
+		set = d.parse(pkg)
+		d.pkgs[pkg.Path()] = set
+	}
+	return set[key]
+}
+
+// fieldKey returns Struct.Field for a field of a package level struct type.
+func fieldKey(field *types.Var) string {
+	scope := field.Pkg().Scope()
+	for _, name := range scope.Names() {
+		t, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		st, ok := t.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			if f := st.Field(i); f == field || (f.Pos() == field.Pos() && f.Name() == field.Name()) {
+				return name + "." + field.Name()
+			}
+		}
+	}
+	return ""
+}
+
+func (d *deprecations) parse(pkg *types.Package) map[string]bool {
+	set := make(map[string]bool)
+	dir := d.dir
+	if pkg != d.local[0] && pkg != d.local[1] {
+		bp, _ := d.w.importPath(d.dir, pkg.Path(), build.FindOnly)
+		if bp == nil || bp.Dir == "" {
+			return set
+		}
+		dir = bp.Dir
+	}
+	bp, _ := d.w.Context.ImportDir(dir, 0)
+	if bp == nil {
+		return set
+	}
+	var files []string
+	for _, list := range [][]string{bp.GoFiles, bp.CgoFiles, bp.TestGoFiles, bp.XTestGoFiles} {
+		files = append(files, list...)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		filename := filepath.Join(bp.Dir, name)
+		src, err := d.w.fileData(filename)
+		if err != nil {
+			continue
+		}
+		f, _ := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if f == nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				key := decl.Name.Name
+				if decl.Recv != nil && len(decl.Recv.List) > 0 {
+					if name := recvBaseName(decl.Recv.List[0].Type); name != "" {
+						key = name + "." + key
+					}
+				}
+				set[key] = set[key] || isDeprecated(decl.Doc)
+			case *ast.GenDecl:
+				group := isDeprecated(decl.Doc)
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						set[spec.Name.Name] = set[spec.Name.Name] || group || isDeprecated(spec.Doc)
+						if st, ok := spec.Type.(*ast.StructType); ok {
+							for _, field := range st.Fields.List {
+								for _, id := range field.Names {
+									set[spec.Name.Name+"."+id.Name] = isDeprecated(field.Doc)
+								}
+							}
+						}
+					case *ast.ValueSpec:
+						for _, id := range spec.Names {
+							set[id.Name] = set[id.Name] || group || isDeprecated(spec.Doc)
+						}
+					}
+				}
+			}
+		}
+	}
+	return set
+}
+
+// isDefaultLibrary reports whether obj is an object of the universe or of
+// the standard library, or the name of a standard library package.
+func isDefaultLibrary(obj types.Object) bool {
+	if name, ok := obj.(*types.PkgName); ok {
+		return stdlib.IsStdPkg(name.Imported().Path())
+	}
+	return obj.Pkg() == nil || stdlib.IsStdPkg(obj.Pkg().Path())
+}
+
+// recvBaseName returns the name of the receiver base type of typ.
+func recvBaseName(typ ast.Expr) string {
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			if x := unindex(typ); x != typ {
+				typ = x
+				continue
+			}
+			return ""
+		}
+	}
+}
+
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, para := range strings.Split(doc.Text(), "\n\n") {
+		if strings.HasPrefix(para, "Deprecated: ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/visualfc/gotools/pkg/typeparams"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Signature is the signature of the call at the cursor.
+type Signature struct {
+	Label  string       `json:"label"`
+	Doc    string       `json:"doc,omitempty"`
+	Active int          `json:"active"`
+	Params []*Parameter `json:"params"`
+}
+
+// Parameter is a parameter of a Signature.
+type Parameter struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	Doc  string `json:"doc,omitempty"`
+}
+
+// LookupSignature prints the signature of the innermost call whose argument
+// list contains the cursor: the signature, the index of the active
+// parameter, one line for each parameter with its doc and the doc of the
+// function.
+func (w *PkgWalker) LookupSignature(conf *PkgConfig, cursor *FileCursor) error {
+	pkg, info := conf.Pkg, conf.Info
+	if cursor.xtest {
+		pkg, info = conf.XPkg, conf.XInfo
+	}
+	file, _ := w.parseFile(cursor.fileDir, cursor.fileName)
+	if file == nil || pkg == nil {
+		return fmt.Errorf("not found file %v", cursor.fileName)
+	}
+	path, _ := astutil.PathEnclosingInterval(file, cursor.pos, cursor.pos)
+	var call *ast.CallExpr
+loop:
+	for _, node := range path {
+		switch node := node.(type) {
+		case *ast.CallExpr:
+			if node.Lparen < cursor.pos && (cursor.pos <= node.Rparen || !node.Rparen.IsValid()) {
+				call = node
+				break loop
+			}
+		case *ast.FuncLit, *ast.BlockStmt:
+			break loop
+		}
+	}
+	if call == nil {
+		return fmt.Errorf("not found call expression")
+	}
+
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, pkg) {
+			return ""
+		}
+		return p.Name()
+	}
+	var sig *Signature
+	fun := unparen(call.Fun)
+	var id *ast.Ident
+	switch fun := uninstance(info, fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	}
+	tv := info.Types[fun]
+	switch {
+	case tv.IsType():
+		typ := types.TypeString(tv.Type, qualifier)
+		sig = &Signature{Label: typ + "(x)", Params: []*Parameter{{Name: "x", Type: typ}}}
+		if named, ok := tv.Type.(*types.Named); ok {
+			sig.Doc = w.objectDoc(named.Obj())
+		}
+	case tv.IsBuiltin() && id != nil:
+		sig = builtinSignature(id.Name)
+		if sig == nil {
+			return fmt.Errorf("not found builtin %v", id.Name)
+		}
+	default:
+		s, ok := tv.Type.(*types.Signature)
+		if !ok && tv.Type != nil {
+			s, ok = tv.Type.Underlying().(*types.Signature)
+		}
+		if !ok {
+			return fmt.Errorf("%v is not a function", w.nodeString(call.Fun))
+		}
+		name := w.nodeString(uninstance(info, fun))
+		var obj types.Object
+		if id != nil {
+			name = id.Name
+			obj = info.Uses[id]
+		}
+		sig = &Signature{}
+		params := s.Params()
+		var list []string
+		for i := 0; i < params.Len(); i++ {
+			p := params.At(i)
+			typ := types.TypeString(p.Type(), qualifier)
+			if s.Variadic() && i == params.Len()-1 {
+				if slice, ok := p.Type().(*types.Slice); ok {
+					typ = "..." + types.TypeString(slice.Elem(), qualifier)
+				}
+			}
+			sig.Params = append(sig.Params, &Parameter{Name: p.Name(), Type: typ})
+			list = append(list, strings.TrimSpace(p.Name()+" "+typ))
+		}
+		sig.Label = "func " + name
+		if id != nil {
+			sig.Label += typeparams.TypeArgs(info, id, qualifier)
+		}
+		sig.Label += "(" + strings.Join(list, ", ") + ")"
+		if results := s.Results(); results.Len() == 1 && results.At(0).Name() == "" {
+			sig.Label += " " + types.TypeString(results.At(0).Type(), qualifier)
+		} else if results.Len() > 0 {
+			sig.Label += " " + types.TypeString(results, qualifier)
+		}
+		if obj != nil {
+			sig.Doc = w.objectDoc(obj)
+			for i, doc := range w.paramDocs(obj) {
+				if i < len(sig.Params) {
+					sig.Params[i].Doc = doc
+				}
+			}
+		}
+	}
+	for i, arg := range call.Args {
+		if cursor.pos > arg.End() {
+			sig.Active = i + 1
+		}
+	}
+	if len(sig.Params) > 0 && strings.HasPrefix(sig.Params[len(sig.Params)-1].Type, "...") && sig.Active >= len(sig.Params) {
+		sig.Active = len(sig.Params) - 1
+	}
+
+	lines := []string{sig.Label, strconv.Itoa(sig.Active)}
+	for _, p := range sig.Params {
+		line := strings.TrimSpace(p.Name + " " + p.Type)
+		if p.Doc != "" {
+			line += "\t// " + strings.Replace(strings.TrimSpace(p.Doc), "\n", " ", -1)
+		}
+		lines = append(lines, line)
+	}
+	if sig.Doc != "" {
+		lines = append(lines, strings.TrimRight(sig.Doc, "\n"))
+	}
+	w.cmd.PrintResult(sig, strings.Join(lines, "\n"))
+	return nil
+}
+
+// builtinSignature returns the signature of the builtin function name from
+// builtinInfoMap.
+func builtinSignature(name string) *Signature {
+	info, ok := builtinInfoMap[name]
+	if !ok || !strings.HasPrefix(info, "func ") {
+		return nil
+	}
+	sig := &Signature{Label: info}
+	i := strings.Index(info, "(")
+	j := strings.Index(info, ")")
+	if i < 0 || j < i {
+		return sig
+	}
+	if params := info[i+1 : j]; params != "" {
+		for _, param := range strings.Split(params, ", ") {
+			p := &Parameter{Type: param}
+			if k := strings.Index(param, " "); k >= 0 {
+				p.Name, p.Type = param[:k], param[k+1:]
+			}
+			sig.Params = append(sig.Params, p)
+		}
+	}
+	// names sharing the type of the next parameter, as in copy(dst, src []Type)
+	for i := len(sig.Params) - 2; i >= 0; i-- {
+		if p := sig.Params[i]; p.Name == "" && unicode.IsLower(rune(p.Type[0])) {
+			p.Name, p.Type = p.Type, sig.Params[i+1].Type
+		}
+	}
+	return sig
+}
+
+// paramDocs returns the doc comments of the parameters of the declaration of
+// the function obj: the comment above a parameter or at the end of its line.
+func (w *PkgWalker) paramDocs(obj types.Object) (docs []string) {
+	path := w.declPath(obj)
+	if len(path) == 0 {
+		return nil
+	}
+	file, _ := path[len(path)-1].(*ast.File)
+	var ftype *ast.FuncType
+	for _, node := range path {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			ftype = node.Type
+		case *ast.Field:
+			ftype, _ = node.Type.(*ast.FuncType)
+		}
+		if ftype != nil {
+			break
+		}
+	}
+	if file == nil || ftype == nil || ftype.Params == nil {
+		return nil
+	}
+	prev := w.FileSet.Position(ftype.Params.Opening).Line
+	for _, field := range ftype.Params.List {
+		start := w.FileSet.Position(field.Pos()).Line
+		end := w.FileSet.Position(field.End()).Line
+		var text string
+		for _, group := range file.Comments {
+			line := w.FileSet.Position(group.Pos()).Line
+			if line == end || (line > prev && w.FileSet.Position(group.End()).Line == start-1) {
+				if group.Pos() > ftype.Params.Opening && group.End() < ftype.Params.Closing {
+					text = group.Text()
+				}
+			}
+		}
+		prev = end
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			docs = append(docs, text)
+		}
+	}
+	return
+}
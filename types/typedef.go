@@ -0,0 +1,199 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// LookupTypeDef prints the type of the cursor expression: with
+// FindMode.TypeDef the position of the declaration of its named element
+// type, the type with pointers, slices, arrays, maps and channels stripped,
+// and with FindMode.Explain the chain of the declared types down to the
+// underlying type, as MyHandler -> http.HandlerFunc -> func(...).
+func (w *PkgWalker) LookupTypeDef(pkg *types.Package, info *types.Info, cursor *FileCursor, obj types.Object) (err error) {
+	typ := cursorType(info, cursor.pos, obj)
+	if typ == nil {
+		return fmt.Errorf("not found type")
+	}
+	if w.findMode.TypeDef {
+		elem := typ
+	loop:
+		for {
+			switch t := elem.(type) {
+			case *types.Pointer:
+				elem = t.Elem()
+			case *types.Slice:
+				elem = t.Elem()
+			case *types.Array:
+				elem = t.Elem()
+			case *types.Map:
+				elem = t.Elem()
+			case *types.Chan:
+				elem = t.Elem()
+			default:
+				break loop
+			}
+		}
+		if tn := typeNameOf(elem); tn == nil {
+			err = fmt.Errorf("%v is not a named type", elem)
+		} else if tn.Pkg() == nil {
+			err = fmt.Errorf("%v is a predeclared type", tn.Name())
+		} else {
+			w.printPos("typedef", w.sourcePos(tn))
+		}
+	}
+	if w.findMode.Explain {
+		w.printText("explain", strings.Join(w.explainType(pkg, typ), " -> "))
+	}
+	return err
+}
+
+// cursorType returns the type of the object defined at pos, or of the
+// innermost expression at pos, or else the type of obj.
+func cursorType(info *types.Info, pos token.Pos, obj types.Object) types.Type {
+	for id, def := range info.Defs {
+		if def != nil && pos >= id.Pos() && pos <= id.End() {
+			return def.Type()
+		}
+	}
+	var expr ast.Expr
+	var typ types.Type
+	for e, tv := range info.Types {
+		if tv.Type == nil || pos < e.Pos() || pos > e.End() {
+			continue
+		}
+		if expr == nil || e.End()-e.Pos() < expr.End()-expr.Pos() {
+			expr, typ = e, tv.Type
+		}
+	}
+	if typ == nil && obj != nil {
+		typ = obj.Type()
+	}
+	return typ
+}
+
+// typeNameOf returns the type name of a named type, alias or type parameter.
+func typeNameOf(typ types.Type) *types.TypeName {
+	if t, ok := typ.(interface{ Obj() *types.TypeName }); ok {
+		return t.Obj()
+	}
+	return nil
+}
+
+// explainType returns typ and the types of the type declarations it is
+// declared by in turn, followed by the underlying type.
+func (w *PkgWalker) explainType(pkg *types.Package, typ types.Type) []string {
+	qualifier := func(p *types.Package) string {
+		if IsSamePkg(p, pkg) {
+			return ""
+		}
+		return p.Name()
+	}
+	chain := []string{types.TypeString(typ, qualifier)}
+	seen := make(map[string]bool)
+	for tn := typeNameOf(typ); tn != nil && tn.Pkg() != nil; {
+		pos := w.sourcePos(tn)
+		key := w.FileSet.Position(pos).String()
+		if seen[key] {
+			break
+		}
+		seen[key] = true
+		file, spec := w.typeSpecAt(pos)
+		if spec == nil {
+			break
+		}
+		next := lookupTypeExpr(tn, file, spec.Type)
+		if next == nil {
+			break
+		}
+		text := next.Name()
+		if next.Pkg() != nil && !IsSamePkg(next.Pkg(), pkg) {
+			text = next.Pkg().Name() + "." + text
+		}
+		if x := unindex(spec.Type); x != spec.Type {
+			text += strings.TrimPrefix(types.ExprString(spec.Type), types.ExprString(x))
+		}
+		chain = append(chain, text)
+		tn = next
+	}
+	if under := types.TypeString(typ.Underlying(), qualifier); under != chain[len(chain)-1] {
+		chain = append(chain, under)
+	}
+	return chain
+}
+
+// typeSpecAt returns the parsed file and the type spec of the type name
+// declared at pos.
+func (w *PkgWalker) typeSpecAt(pos token.Pos) (*ast.File, *ast.TypeSpec) {
+	if !pos.IsValid() {
+		return nil, nil
+	}
+	file := w.ParsedFileCache[w.FileSet.Position(pos).Filename]
+	if file == nil || pos < file.Pos() || pos > file.End() {
+		return nil, nil
+	}
+	var spec *ast.TypeSpec
+	ast.Inspect(file, func(n ast.Node) bool {
+		if s, ok := n.(*ast.TypeSpec); ok && s.Name.Pos() == pos {
+			spec = s
+		}
+		return spec == nil
+	})
+	return file, spec
+}
+
+// lookupTypeExpr returns the type name the type expression expr of the
+// declaration of tn in file denotes, or nil if expr is not a type name.
+func lookupTypeExpr(tn *types.TypeName, file *ast.File, expr ast.Expr) *types.TypeName {
+	for {
+		if p, ok := expr.(*ast.ParenExpr); ok {
+			expr = p.X
+			continue
+		}
+		if x := unindex(expr); x != expr {
+			expr = x
+			continue
+		}
+		break
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		scope := tn.Parent()
+		if scope == nil {
+			scope = tn.Pkg().Scope()
+		}
+		_, obj := scope.LookupParent(e.Name, token.NoPos)
+		t, _ := obj.(*types.TypeName)
+		return t
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			for _, imp := range tn.Pkg().Imports() {
+				if imp.Path() != path && !strings.HasSuffix(imp.Path(), "/vendor/"+path) {
+					continue
+				}
+				name := imp.Name()
+				if spec.Name != nil {
+					name = spec.Name.Name
+				}
+				if name == x.Name {
+					t, _ := imp.Scope().Lookup(e.Sel.Name).(*types.TypeName)
+					return t
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -25,11 +25,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/visualfc/gomod"
 	"github.com/visualfc/gotools/pkg/buildctx"
 	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/gomod"
+	"github.com/visualfc/gotools/pkg/pkgcache"
 	"github.com/visualfc/gotools/pkg/pkgutil"
+	"github.com/visualfc/gotools/pkg/srcpos"
 	"github.com/visualfc/gotools/pkg/stdlib"
+	"github.com/visualfc/gotools/pkg/typeparams"
 	"golang.org/x/tools/go/buildutil"
 )
 
@@ -46,14 +49,32 @@ var (
 	typesFilePos         string
 	typesCursorText      string
 	typesFileStdin       bool
+	typesOverlay         string
+	typesPosEncoding     string
+	typesShowEnd         bool
 	typesFindUse         bool
 	typesFindDef         bool
 	typesFindUseAll      bool
 	typesFindSkipGoroot  bool
+	typesFindModCache    bool
 	typesFindInfo        bool
 	typesFindDoc         bool
 	typesFindImportRange bool
 	typesFindImport      bool
+	typesFindImpl        bool
+	typesRename          string
+	typesRenameWrite     bool
+	typesFindCallers     bool
+	typesFindCallees     bool
+	typesCallDepth       int
+	typesSignature       bool
+	typesLayout          bool
+	typesMethodSet       bool
+	typesTypeDef         bool
+	typesExplain         bool
+	typesHighlight       bool
+	typesUsageContext    bool
+	typesGOARCH          string
 	typesSkipTests       bool
 	typesTags            string
 	typesTagList         = []string{} // exploded version of tags flag; set in main
@@ -63,19 +84,37 @@ var (
 func init() {
 	Command.Flag.BoolVar(&typesVerbose, "v", false, "verbose debugging")
 	Command.Flag.BoolVar(&typesAllowBinary, "b", false, "import can be satisfied by a compiled package object without corresponding sources.")
-	Command.Flag.StringVar(&typesFilePos, "pos", "", "file position \"file.go:pos\"")
+	Command.Flag.StringVar(&typesFilePos, "pos", "", "file position \"file.go:offset\" or \"file.go:line:column\"")
+	Command.Flag.StringVar(&typesPosEncoding, "posenc", "byte", "encoding of offsets and columns of -pos and results: byte, rune or utf16")
+	Command.Flag.BoolVar(&typesShowEnd, "end", false, "show end positions of results")
 	Command.Flag.StringVar(&typesCursorText, "text", "", "file cursor text info")
 	Command.Flag.BoolVar(&typesFileStdin, "stdin", false, "input file use stdin")
 	Command.Flag.BoolVar(&typesFindInfo, "info", false, "find cursor info")
 	Command.Flag.BoolVar(&typesFindDef, "def", false, "find cursor define")
 	Command.Flag.BoolVar(&typesFindUse, "use", false, "find cursor usages")
-	Command.Flag.BoolVar(&typesFindUseAll, "all", false, "find cursor all usages in GOPATH")
+	Command.Flag.BoolVar(&typesFindUseAll, "all", false, "find cursor all usages in GOPATH or in the workspace modules")
+	Command.Flag.BoolVar(&typesUsageContext, "context", false, "print usages by package with enclosing declaration and line text")
+	Command.Flag.BoolVar(&typesFindModCache, "modcache", false, "find cursor all usages also in the required modules of the module cache")
 	Command.Flag.BoolVar(&typesFindImport, "import", false, "find cursor usages with import")
 	Command.Flag.BoolVar(&typesFindImportRange, "import_range", false, "find cursor usages with import range")
 	Command.Flag.BoolVar(&typesFindSkipGoroot, "skip_goroot", false, "find cursor all usages skip GOROOT")
 	Command.Flag.BoolVar(&typesSkipTests, "skip_tests", false, "find cursor all usages skip tests")
 	Command.Flag.BoolVar(&typesFindDoc, "doc", false, "find cursor def doc")
+	Command.Flag.BoolVar(&typesFindImpl, "impl", false, "find cursor implementations or implemented interfaces (use -all for GOPATH)")
+	Command.Flag.StringVar(&typesRename, "rename", "", "rename cursor object to new name in all referencing packages")
+	Command.Flag.BoolVar(&typesRenameWrite, "w", false, "write rename edits or layout field order to files")
+	Command.Flag.BoolVar(&typesFindCallers, "callers", false, "find cursor function incoming calls (use -all for GOPATH)")
+	Command.Flag.BoolVar(&typesFindCallees, "callees", false, "find cursor function outgoing calls")
+	Command.Flag.IntVar(&typesCallDepth, "depth", 1, "depth of -callers and -callees call tree")
+	Command.Flag.BoolVar(&typesSignature, "signature", false, "find cursor call signature and active parameter")
+	Command.Flag.BoolVar(&typesLayout, "layout", false, "print cursor struct layout and optimal field order (use -w to reorder)")
+	Command.Flag.BoolVar(&typesMethodSet, "methodset", false, "print cursor type method sets of T and *T and its embedded types")
+	Command.Flag.BoolVar(&typesTypeDef, "typedef", false, "find cursor expression type definition")
+	Command.Flag.BoolVar(&typesExplain, "explain", false, "print cursor expression type declaration chain to underlying type")
+	Command.Flag.BoolVar(&typesHighlight, "highlight", false, "find cursor object occurrences in file as definition, read or write")
+	Command.Flag.StringVar(&typesGOARCH, "goarch", "", "GOARCH of -layout sizes (default build context GOARCH)")
 	Command.Flag.StringVar(&typesTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.StringVar(&typesOverlay, "overlay", "", "txtar archive or json map of file names to unsaved contents (- for stdin)")
 }
 
 type ObjKind int
@@ -98,6 +137,8 @@ const (
 	ObjImplicit
 	ObjUnknown
 	ObjComment
+	ObjTypeParam
+	ObjConstraint
 )
 
 var ObjKindName = []string{"none", "package", "package",
@@ -105,7 +146,8 @@ var ObjKindName = []string{"none", "package", "package",
 	"const", "var", "field",
 	"func", "method",
 	"label", "builtin", "nil",
-	"implicit", "unknown", "comment"}
+	"implicit", "unknown", "comment",
+	"typeparam", "constraint"}
 
 func (k ObjKind) String() string {
 	if k >= 0 && int(k) < len(ObjKindName) {
@@ -144,12 +186,16 @@ func builtinInfo(id string) string {
 }
 
 func (w *PkgWalker) simpleObjInfo(obj types.Object) string {
-	return types.ObjectString(obj, func(pkg *types.Package) string {
-		if pkg == w.lookup {
-			return ""
-		}
-		return pkg.Name()
-	})
+	return types.ObjectString(obj, w.qualifier)
+}
+
+// qualifier qualifies the objects of packages other than the package of the
+// lookup by the package name.
+func (w *PkgWalker) qualifier(pkg *types.Package) string {
+	if pkg == w.lookup {
+		return ""
+	}
+	return pkg.Name()
 }
 
 func runTypes(cmd *command.Command, args []string) error {
@@ -163,21 +209,42 @@ func runTypes(cmd *command.Command, args []string) error {
 			cmd.Println("time", time.Now().Sub(now))
 		}()
 	}
+	var overlay buildctx.Overlay
+	if typesOverlay != "" {
+		if typesOverlay == "-" && typesFileStdin {
+			return fmt.Errorf("-overlay - and -stdin both read stdin")
+		}
+		var err error
+		if overlay, err = buildctx.LoadOverlay(typesOverlay, cmd.Stdin); err != nil {
+			return err
+		}
+		defer buildctx.SetOverlay(nil)
+	}
+	posEncoding, err := srcpos.ParseEncoding(typesPosEncoding)
+	if err != nil {
+		return err
+	}
 	typesTagList = strings.Split(typesTags, " ")
 	context := buildctx.System()
 	context.BuildTags = append(typesTagList, context.BuildTags...)
 
-	w := NewPkgWalker(context)
+	w := LookupPkgWalker(context)
+	defer w.ClearSourceData()
+	for filename, data := range overlay {
+		if data != nil {
+			w.UpdateSourceData(filename, data, false)
+		}
+	}
 	cursor := &FileCursor{}
 	cursor.text = typesCursorText
 	if typesFilePos != "" {
-		pos := strings.Index(typesFilePos, ":")
-		if pos != -1 {
-			cursor.fileName = typesFilePos[:pos]
-			if i, err := strconv.Atoi(typesFilePos[pos+1:]); err == nil {
-				cursor.cursorPos = i
-			}
+		pos, err := srcpos.ParsePos(typesFilePos)
+		if err != nil {
+			return err
 		}
+		cursor.fileName = pos.Filename
+		cursor.cursorPos = pos.Offset
+		cursor.SetLineColumn(pos.Line, pos.Column)
 		if typesFileStdin {
 			src, err := ioutil.ReadAll(cmd.Stdin)
 			if err == nil {
@@ -186,15 +253,32 @@ func runTypes(cmd *command.Command, args []string) error {
 		}
 	}
 	w.cmd = cmd
+	w.PosEncoding = posEncoding
 	w.findMode = &FindMode{
 		Info:        typesFindInfo,
 		Define:      typesFindDef,
 		Doc:         typesFindDoc,
 		Usage:       typesFindUse,
 		UsageAll:    typesFindUseAll,
+		Context:     typesUsageContext,
 		Import:      typesFindImport,
 		ImportRange: typesFindImportRange,
 		SkipGoroot:  typesFindSkipGoroot,
+		ModCache:    typesFindModCache,
+		Implements:  typesFindImpl,
+		Rename:      typesRename,
+		Write:       typesRenameWrite,
+		Callers:     typesFindCallers,
+		Callees:     typesFindCallees,
+		Depth:       typesCallDepth,
+		Signature:   typesSignature,
+		Layout:      typesLayout,
+		MethodSet:   typesMethodSet,
+		TypeDef:     typesTypeDef,
+		Explain:     typesExplain,
+		Highlight:   typesHighlight,
+		GOARCH:      typesGOARCH,
+		End:         typesShowEnd,
 	}
 
 	for _, pkgName := range args {
@@ -225,6 +309,8 @@ type FileCursor struct {
 	fileName  string
 	fileDir   string
 	cursorPos int
+	line      int
+	column    int
 	pos       token.Pos
 	src       []byte
 	xtest     bool
@@ -239,6 +325,30 @@ func (f *FileCursor) SetText(text string) {
 	f.text = text
 }
 
+// SetLineColumn sets the cursor to the 1-based line and column instead of
+// the offset.
+func (f *FileCursor) SetLineColumn(line, column int) {
+	f.line, f.column = line, column
+}
+
+// cursorOffset returns the byte offset of the cursor in filename. Offsets
+// and columns count units of w.PosEncoding.
+func (w *PkgWalker) cursorOffset(cursor *FileCursor, filename string) int {
+	if cursor.line == 0 && w.PosEncoding == srcpos.Byte {
+		return cursor.cursorPos
+	}
+	src, err := w.fileData(filename)
+	if err != nil {
+		return cursor.cursorPos
+	}
+	return cursor.byteOffset(src, w.PosEncoding)
+}
+
+func (f *FileCursor) byteOffset(src []byte, enc srcpos.Encoding) int {
+	p := srcpos.Pos{Offset: f.cursorPos, Line: f.line, Column: f.column}
+	return p.ByteOffset(src, enc)
+}
+
 type SourceData struct {
 	data  []byte
 	mtime int64
@@ -250,13 +360,29 @@ type FindMode struct {
 	Define      bool
 	Usage       bool
 	UsageAll    bool
+	Context     bool // print usages with package, enclosing declaration and line text
 	Import      bool
 	ImportRange bool
 	SkipGoroot  bool
+	ModCache    bool
+	Implements  bool
+	Rename      string
+	Write       bool
+	Callers     bool
+	Callees     bool
+	Depth       int
+	Signature   bool
+	Layout      bool
+	MethodSet   bool
+	TypeDef     bool
+	Explain     bool
+	Highlight   bool
+	GOARCH      string
+	End         bool // print end positions of results
 }
 
 func (f *FindMode) IsValid() bool {
-	return f.Info || f.Define || f.Usage
+	return f.Info || f.Define || f.Usage || f.Implements || f.Rename != "" || f.Callers || f.Callees || f.Signature || f.Layout || f.MethodSet || f.TypeDef || f.Explain || f.Highlight
 }
 
 type PkgConfig struct {
@@ -270,26 +396,13 @@ type PkgConfig struct {
 	IgnoreFuncBodies bool
 	AllowBinary      bool
 	WithTestFiles    bool
+	Errors           []error // parse and type errors of the package and its external tests
 }
 
 func NewPkgConfig(ignoreFuncBodies bool, withTestFiles bool) *PkgConfig {
 	conf := &PkgConfig{IgnoreFuncBodies: ignoreFuncBodies, AllowBinary: true, WithTestFiles: withTestFiles}
-	conf.Info = &types.Info{
-		Uses:       make(map[*ast.Ident]types.Object),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Scopes:     make(map[ast.Node]*types.Scope),
-		Implicits:  make(map[ast.Node]types.Object),
-	}
-	conf.XInfo = &types.Info{
-		Uses:       make(map[*ast.Ident]types.Object),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Scopes:     make(map[ast.Node]*types.Scope),
-		Implicits:  make(map[ast.Node]types.Object),
-	}
+	conf.Info = newInfo()
+	conf.XInfo = newInfo()
 	return conf
 }
 
@@ -302,13 +415,20 @@ type PkgWalker struct {
 	ParsedFileCache    map[string]*ast.File
 	ParsedFileModTime  map[string]int64
 	fileSourceData     map[string]*SourceData
+	parseErrors        map[string]error
 	Imported           map[string]*types.Package // packages already imported
 	ImportedConfig     map[string]*PkgConfig
 	ImportedFilesCheck map[string]*FilesCheck
 	gcimported         types.Importer
 	cmd                *command.Command
-	Mod                *gomod.Package
+	Mod                *gomod.Workspace
 	findMode           *FindMode
+	ExportCache        *pkgcache.Cache // export data of dependencies, nil if disabled
+	exportKeys         map[string]string
+	exportPkgs         map[*types.Package]string
+	PosEncoding        srcpos.Encoding // encoding of cursor offsets and columns and of result positions
+	posConv            *srcpos.Converter
+	modPkgs            map[string]*modPackages // packages of module directories
 }
 
 func NewPkgWalker(context *build.Context) *PkgWalker {
@@ -318,15 +438,81 @@ func NewPkgWalker(context *build.Context) *PkgWalker {
 		ParsedFileCache:    map[string]*ast.File{},
 		ParsedFileModTime:  map[string]int64{},
 		fileSourceData:     map[string]*SourceData{},
+		parseErrors:        map[string]error{},
 		importingName:      map[string]bool{},
 		Imported:           map[string]*types.Package{"unsafe": types.Unsafe},
 		ImportedConfig:     map[string]*PkgConfig{},
 		ImportedFilesCheck: map[string]*FilesCheck{},
 		gcimported:         importer.Default(),
 		findMode:           &FindMode{},
+		ExportCache:        pkgcache.Default(),
+		exportKeys:         map[string]string{},
+		exportPkgs:         map[*types.Package]string{},
+		modPkgs:            map[string]*modPackages{},
 	}
 }
 
+var (
+	walkerCacheEnable bool
+	walkerCache       = make(map[string]*PkgWalker)
+)
+
+// EnableWalkerCache keeps the PkgWalker of each build context alive between
+// runs of the types command, so parsed files and imported packages are reused.
+func EnableWalkerCache(enable bool) {
+	walkerCacheEnable = enable
+	if !enable {
+		walkerCache = make(map[string]*PkgWalker)
+	}
+}
+
+// InvalidateCache drops the cached source data and parsed files of filenames
+// and the package list of a module if a filename is in a new package
+// directory. If no filename is given all cached walkers are dropped.
+func InvalidateCache(filenames ...string) {
+	if len(filenames) == 0 {
+		walkerCache = make(map[string]*PkgWalker)
+		return
+	}
+	for _, w := range walkerCache {
+		for _, filename := range filenames {
+			delete(w.fileSourceData, filename)
+			delete(w.ParsedFileCache, filename)
+			delete(w.ParsedFileModTime, filename)
+			delete(w.parseErrors, filename)
+			// a file of a new package directory
+			dir := filepath.Dir(filename)
+			for root, pkgs := range w.modPkgs {
+				if !pkgs.dirs[dir] && (dir == root || strings.HasPrefix(dir, root+string(filepath.Separator))) {
+					delete(w.modPkgs, root)
+				}
+			}
+		}
+	}
+}
+
+func contextKey(context *build.Context) string {
+	return fmt.Sprintf("%s/%s/%v/%s/%s/%v/%v", context.GOOS, context.GOARCH, context.CgoEnabled,
+		context.GOROOT, context.GOPATH, context.BuildTags, context.OpenFile != nil)
+}
+
+// LookupPkgWalker returns the cached PkgWalker of context if the walker cache
+// is enabled, or a new PkgWalker.
+func LookupPkgWalker(context *build.Context) *PkgWalker {
+	if !walkerCacheEnable {
+		return NewPkgWalker(context)
+	}
+	key := contextKey(context)
+	if w, ok := walkerCache[key]; ok {
+		w.lookup = nil
+		w.findMode = &FindMode{}
+		return w
+	}
+	w := NewPkgWalker(context)
+	walkerCache[key] = w
+	return w
+}
+
 func (w *PkgWalker) SetOutput(stdout io.Writer, stderr io.Writer) {
 	cmd := &command.Command{}
 	cmd.Stdout = stdout
@@ -351,6 +537,18 @@ func (w *PkgWalker) UpdateSourceData(filename string, data []byte, cleanAllSourc
 	w.fileSourceData[filename] = &SourceData{data, time.Now().UnixNano()}
 }
 
+// ClearSourceData drops the source data set by UpdateSourceData, as the
+// unsaved buffers of a request, and the files parsed from it. Packages
+// checked with the source data are checked again from disk.
+func (w *PkgWalker) ClearSourceData() {
+	for filename := range w.fileSourceData {
+		delete(w.ParsedFileCache, filename)
+		delete(w.ParsedFileModTime, filename)
+		delete(w.parseErrors, filename)
+	}
+	w.fileSourceData = make(map[string]*SourceData)
+}
+
 func (p *PkgWalker) Check(name string, conf *PkgConfig, cusror *FileCursor) (pkg *types.Package, outconf *PkgConfig, err error) {
 	if name == "." {
 		name, _ = os.Getwd()
@@ -360,19 +558,15 @@ func (p *PkgWalker) Check(name string, conf *PkgConfig, cusror *FileCursor) (pkg
 	}
 	//p.Imported[name] = nil
 	p.importingName = make(map[string]bool)
+	p.exportKeys = make(map[string]string)
+	p.posConv = &srcpos.Converter{Encoding: p.PosEncoding, ReadFile: p.fileData}
 	// check go mod and skip GOROOT
 	p.Mod = nil
 	var import_path string
 	if filepath.IsAbs(name) && !strings.HasPrefix(name, runtime.GOROOT()) {
-		p.Mod, _ = gomod.Load(name, p.Context)
+		p.Mod, _ = gomod.LoadWorkspace(name, p.Context)
 		if p.Mod != nil {
-			dir := filepath.ToSlash(p.Mod.Root().Dir)
-			fname := filepath.ToSlash(name)
-			if dir == fname {
-				import_path = p.Mod.Root().Path
-			} else if strings.HasPrefix(fname, dir+"/") {
-				import_path = p.Mod.Root().Path + fname[len(dir):]
-			}
+			import_path, _ = p.Mod.ImportPath(filepath.Clean(name))
 		}
 	}
 	pkg, outconf, err = p.ImportHelper("", name, import_path, conf, cusror)
@@ -388,7 +582,12 @@ func contains(list []string, s string) bool {
 	return false
 }
 
+// isBinaryPkg reports whether pkg is imported from export data. Export data
+// is built for the host, so for other GOOS/GOARCH the sources are checked.
 func (w *PkgWalker) isBinaryPkg(pkg string) bool {
+	if w.Context.GOOS != runtime.GOOS || w.Context.GOARCH != runtime.GOARCH {
+		return false
+	}
 	return stdlib.IsStdPkg(pkg)
 }
 
@@ -418,6 +617,23 @@ func (w *PkgWalker) importPath(parentDir string, path string, mode build.ImportM
 	return w.Context.Import(path, "", mode)
 }
 
+// resolveImport returns the name of the package imported as name by the
+// package in parentDir: relative imports are joined to parentDir and in
+// GOPATH mode vendored packages are preferred.
+func (w *PkgWalker) resolveImport(parentDir string, name string) (string, error) {
+	if parentDir == "" {
+		return name, nil
+	}
+	if strings.HasPrefix(name, ".") {
+		return filepath.Join(parentDir, name), nil
+	}
+	if w.Mod == nil && pkgutil.IsVendorExperiment() {
+		parentPkg := pkgutil.ImportDirEx(w.Context, parentDir)
+		return pkgutil.VendoredImportPath(parentPkg, name)
+	}
+	return name, nil
+}
+
 func (w *PkgWalker) Import(parentDir string, name string, conf *PkgConfig, cursor *FileCursor) (pkg *types.Package, outconf *PkgConfig, err error) {
 	return w.ImportHelper(parentDir, name, "", conf, cursor)
 }
@@ -425,19 +641,22 @@ func (w *PkgWalker) Import(parentDir string, name string, conf *PkgConfig, curso
 type FilesCheck struct {
 	HashSum [16]byte
 	ModTime int64
+	Dir     string
+	Files   []string
 }
 
 func (w *PkgWalker) checkFiles(dir string, files []string) *FilesCheck {
-	chk := &FilesCheck{}
+	chk := &FilesCheck{Dir: dir, Files: files}
 	sort.Strings(files)
 	var temp string
 	for _, file := range files {
 		filename := filepath.Join(dir, file)
-		info, err := os.Lstat(filename)
-		if err != nil {
+		var t int64
+		if info, err := os.Lstat(filename); err == nil {
+			t = info.ModTime().UnixNano()
+		} else if _, ok := w.fileSourceData[filename]; !ok {
 			continue
 		}
-		t := info.ModTime().UnixNano()
 		if sd, ok := w.fileSourceData[filename]; ok {
 			if sd.mtime > t {
 				t = sd.mtime
@@ -454,6 +673,78 @@ func (w *PkgWalker) checkFiles(dir string, files []string) *FilesCheck {
 	return chk
 }
 
+// dropDependents removes every imported package that depends on old,
+// so they are checked again against the new version of old.
+func (w *PkgWalker) dropDependents(old *types.Package) {
+	for name, pkg := range w.Imported {
+		if pkg == nil || pkg == old {
+			continue
+		}
+		if dependsOn(pkg, old, make(map[*types.Package]bool)) {
+			delete(w.Imported, name)
+			delete(w.ImportedConfig, name)
+			delete(w.ImportedFilesCheck, name)
+		}
+	}
+}
+
+// staleImports reports whether a direct or indirect import of pkg was
+// changed or dropped since pkg was checked.
+func (w *PkgWalker) staleImports(pkg *types.Package) bool {
+	names := make(map[*types.Package]string)
+	for name, p := range w.Imported {
+		if p != nil {
+			names[p] = name
+		}
+	}
+	seen := make(map[*types.Package]bool)
+	var stale func(pkg *types.Package) bool
+	stale = func(pkg *types.Package) bool {
+		for _, im := range pkg.Imports() {
+			if seen[im] || im == types.Unsafe || w.isBinaryPkg(im.Path()) {
+				continue
+			}
+			seen[im] = true
+			name, ok := names[im]
+			if !ok {
+				return true
+			}
+			if key, ok := w.exportPkgs[im]; ok {
+				bp, _ := w.importPath("", name, 0)
+				if bp == nil || w.exportKey(bp, make(map[string]bool)) != key {
+					return true
+				}
+				// the key covers the imports of im
+				continue
+			}
+			if chk := w.ImportedFilesCheck[name]; chk != nil {
+				cur := w.checkFiles(chk.Dir, append([]string{}, chk.Files...))
+				if cur.ModTime != chk.ModTime || cur.HashSum != chk.HashSum {
+					return true
+				}
+			}
+			if stale(im) {
+				return true
+			}
+		}
+		return false
+	}
+	return stale(pkg)
+}
+
+func dependsOn(pkg *types.Package, dep *types.Package, seen map[*types.Package]bool) bool {
+	if seen[pkg] {
+		return false
+	}
+	seen[pkg] = true
+	for _, im := range pkg.Imports() {
+		if im == dep || dependsOn(im, dep, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *PkgWalker) ImportHelper(parentDir string, name string, import_path string, conf *PkgConfig, cursor *FileCursor) (pkg *types.Package, outconf *PkgConfig, err error) {
 	defer func() {
 		err := recover()
@@ -462,19 +753,9 @@ func (w *PkgWalker) ImportHelper(parentDir string, name string, import_path stri
 		}
 	}()
 
-	if parentDir != "" {
-		if strings.HasPrefix(name, ".") {
-			name = filepath.Join(parentDir, name)
-		} else {
-			if w.Mod == nil && pkgutil.IsVendorExperiment() {
-				parentPkg := pkgutil.ImportDirEx(w.Context, parentDir)
-				var err error
-				name, err = pkgutil.VendoredImportPath(parentPkg, name)
-				if err != nil {
-					return nil, nil, err
-				}
-			}
-		}
+	name, err = w.resolveImport(parentDir, name)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	bp, err := w.importPath(parentDir, name, 0)
@@ -498,7 +779,7 @@ func (w *PkgWalker) ImportHelper(parentDir string, name string, import_path stri
 	if cursor != nil && cursor.fileName != "" {
 		f, _ := w.parseFile(bp.Dir, cursor.fileName)
 		if f != nil {
-			cursor.pos = token.Pos(w.FileSet.File(f.Pos()).Base()) + token.Pos(cursor.cursorPos)
+			cursor.pos = token.Pos(w.FileSet.File(f.Pos()).Base()) + token.Pos(w.cursorOffset(cursor, filepath.Join(bp.Dir, cursor.fileName)))
 			cursor.fileDir = bp.Dir
 			isTest := strings.HasSuffix(cursor.fileName, "_test.go")
 			isXTest := false
@@ -528,7 +809,9 @@ func (w *PkgWalker) ImportHelper(parentDir string, name string, import_path stri
 	chkFiles := w.checkFiles(bp.Dir, append(append([]string{}, GoFiles...), XTestGoFiles...))
 	if pkg != nil {
 		if chk, ok := w.ImportedFilesCheck[name]; ok {
-			if chkFiles.ModTime == chk.ModTime && bytes.Equal(chkFiles.HashSum[:], chk.HashSum[:]) {
+			if chkFiles.ModTime != chk.ModTime || !bytes.Equal(chkFiles.HashSum[:], chk.HashSum[:]) {
+				w.dropDependents(pkg)
+			} else if !w.staleImports(pkg) {
 				outconf := w.ImportedConfig[name]
 				if outconf != nil {
 					var errcheck bool
@@ -566,13 +849,17 @@ func (w *PkgWalker) ImportHelper(parentDir string, name string, import_path stri
 
 	w.importingName[checkName] = true
 
+	conf.Errors = nil
 	parserFiles := func(filenames []string, cursor *FileCursor, xtest bool) (files []*ast.File, fileMap map[string]*ast.File) {
 		fileMap = make(map[string]*ast.File)
 		for _, file := range filenames {
 			var f *ast.File
 			f, err = w.parseFile(bp.Dir, file)
+			if perr := w.parseErrors[filepath.Join(bp.Dir, file)]; perr != nil {
+				conf.Errors = append(conf.Errors, perr)
+			}
 			if cursor != nil && cursor.fileName == file {
-				cursor.pos = token.Pos(w.FileSet.File(f.Pos()).Base()) + token.Pos(cursor.cursorPos)
+				cursor.pos = token.Pos(w.FileSet.File(f.Pos()).Base()) + token.Pos(w.cursorOffset(cursor, filepath.Join(bp.Dir, file)))
 				cursor.fileDir = bp.Dir
 				cursor.xtest = xtest
 			}
@@ -594,6 +881,7 @@ func (w *PkgWalker) ImportHelper(parentDir string, name string, import_path stri
 		FakeImportC:      true,
 		Importer:         &Importer{w, conf, bp.Dir},
 		Error: func(err error) {
+			conf.Errors = append(conf.Errors, err)
 			if typesVerbose {
 				fmt.Fprintln(w.cmd.Stderr, err)
 			}
@@ -623,6 +911,12 @@ type Importer struct {
 	dir  string
 }
 
+// NewImporter returns an importer of the packages imported by the package
+// in dir. Dependencies are loaded from the export data cache if enabled.
+func NewImporter(w *PkgWalker, dir string) *Importer {
+	return &Importer{w, NewPkgConfig(true, false), dir}
+}
+
 func (im *Importer) Import(name string) (pkg *types.Package, err error) {
 	if im.conf.AllowBinary && im.w.isBinaryPkg(name) {
 		if found := im.w.Imported[name]; found != nil {
@@ -644,7 +938,15 @@ func (im *Importer) Import(name string) (pkg *types.Package, err error) {
 		//		}
 	}
 
-	pkg, _, err = im.w.Import(im.dir, name, NewPkgConfig(true, false), nil)
+	if pkg := im.w.importExport(im.dir, name); pkg != nil {
+		return pkg, nil
+	}
+	pkg, conf, err := im.w.Import(im.dir, name, NewPkgConfig(true, false), nil)
+	if pkg != nil {
+		im.w.storeExport(pkg, conf)
+		// errors of the imported package are not errors of the importer
+		return pkg, nil
+	}
 	return pkg, err
 }
 
@@ -681,6 +983,11 @@ func (w *PkgWalker) parseFileEx(dir, file string, src interface{}, mtime int64,
 	if f == nil {
 		return f, err
 	}
+	if err != nil {
+		w.parseErrors[filename] = err
+	} else {
+		delete(w.parseErrors, filename)
+	}
 	if mtime != 0 {
 		w.ParsedFileModTime[filename] = mtime
 	} else {
@@ -695,15 +1002,9 @@ func (w *PkgWalker) parseFileEx(dir, file string, src interface{}, mtime int64,
 
 func (w *PkgWalker) LookupCursor(pkg *types.Package, conf *PkgConfig, cursor *FileCursor) error {
 	w.lookup = pkg
-	f, _ := w.parseFile(cursor.fileDir, cursor.fileName)
-	if f != nil {
-		cursor.pos = token.Pos(w.FileSet.File(f.Pos()).Base()) + token.Pos(cursor.cursorPos)
-		isTest := strings.HasSuffix(cursor.fileName, "_test.go")
-		isXTest := false
-		if isTest && strings.HasSuffix(f.Name.Name, "_test") {
-			isXTest = true
-		}
-		cursor.xtest = isXTest
+	w.updateCursor(cursor)
+	if w.findMode.Signature {
+		return w.LookupSignature(conf, cursor)
 	}
 	return w.LookupObjects(conf, cursor)
 	if nm := w.CheckIsName(cursor); nm != nil {
@@ -719,18 +1020,33 @@ func (w *PkgWalker) LookupCursor(pkg *types.Package, conf *PkgConfig, cursor *Fi
 	}
 }
 
+// updateCursor sets the position of the cursor in the parsed cursor file
+// and whether the file is an external test file.
+func (w *PkgWalker) updateCursor(cursor *FileCursor) {
+	f, _ := w.parseFile(cursor.fileDir, cursor.fileName)
+	if f != nil {
+		cursor.pos = token.Pos(w.FileSet.File(f.Pos()).Base()) + token.Pos(w.cursorOffset(cursor, filepath.Join(cursor.fileDir, cursor.fileName)))
+		isTest := strings.HasSuffix(cursor.fileName, "_test.go")
+		isXTest := false
+		if isTest && strings.HasSuffix(f.Name.Name, "_test") {
+			isXTest = true
+		}
+		cursor.xtest = isXTest
+	}
+}
+
 func (w *PkgWalker) LookupName(pkg *types.Package, conf *PkgConfig, cursor *FileCursor, nm *ast.Ident) error {
 	if w.findMode.Define {
-		w.cmd.Println(w.FileSet.Position(nm.Pos()))
+		w.printPos("def", nm.Pos())
 	}
 	if w.findMode.Info {
 		if cursor.xtest {
-			w.cmd.Printf("package %s (%q)\n", pkg.Name()+"_test", pkg.Path())
+			w.printText("info", fmt.Sprintf("package %s (%q)", pkg.Name()+"_test", pkg.Path()))
 		} else {
 			if pkg.Path() == pkg.Name() {
-				w.cmd.Printf("package %s\n", pkg.Name())
+				w.printText("info", fmt.Sprintf("package %s", pkg.Name()))
 			} else {
-				w.cmd.Printf("package %s (%q)\n", pkg.Name(), pkg.Path())
+				w.printText("info", fmt.Sprintf("package %s (%q)", pkg.Name(), pkg.Path()))
 			}
 		}
 	}
@@ -753,7 +1069,7 @@ func (w *PkgWalker) LookupName(pkg *types.Package, conf *PkgConfig, cursor *File
 	}
 	(sort.IntSlice(usages)).Sort()
 	for _, pos := range usages {
-		w.cmd.Println(w.FileSet.Position(token.Pos(pos)))
+		w.printPos("usage", token.Pos(pos))
 	}
 
 	// if !w.findMode.UsageAll {
@@ -951,22 +1267,22 @@ func (w *PkgWalker) LookupImport(pkg *types.Package, pkgInfo *types.Info, cursor
 		}
 		bp, err = w.importPath("", findpath, build.FindOnly)
 		if err == nil {
-			w.cmd.Println(w.FileSet.Position(is.Pos()).String() + "::" + fname + "::" + fpath + "::" + bp.Dir)
+			w.printImportPos(is.Pos(), fname, fpath, bp.Dir)
 		} else {
-			w.cmd.Println(w.FileSet.Position(is.Pos()))
+			w.printPos("def", is.Pos())
 		}
 	}
 
 	if w.findMode.Info {
 		if fname == fpath {
-			w.cmd.Printf("import %s\n", fname)
+			w.printText("info", fmt.Sprintf("import %s", fname))
 		} else {
-			w.cmd.Printf("import %s (%q)\n", fname, fpath)
+			w.printText("info", fmt.Sprintf("import %s (%q)", fname, fpath))
 		}
 	}
 
 	if w.findMode.Doc && bp != nil && bp.Doc != "" {
-		w.cmd.Println(bp.Doc)
+		w.printText("doc", bp.Doc)
 	}
 
 	if !w.findMode.Usage {
@@ -985,7 +1301,7 @@ func (w *PkgWalker) LookupImport(pkg *types.Package, pkgInfo *types.Info, cursor
 	}
 	(sort.IntSlice(usages)).Sort()
 	for _, pos := range usages {
-		w.cmd.Println(w.FileSet.Position(token.Pos(pos)))
+		w.printPos("usage", token.Pos(pos))
 	}
 	return nil
 }
@@ -1013,6 +1329,11 @@ func parserObjKind(obj types.Object) (ObjKind, error) {
 		case *types.Struct:
 			kind = ObjStruct
 		}
+		if typeparams.IsTypeParam(t) {
+			kind = ObjTypeParam
+		} else if typeparams.IsConstraint(t) {
+			kind = ObjConstraint
+		}
 	case *types.Var:
 		kind = ObjVar
 		if t.IsField() {
@@ -1335,7 +1656,7 @@ func parserMethod(obj types.Object) (named *types.Named, method string, ok bool)
 	}
 	recv := sig.Recv()
 	if recv == nil {
-		return
+		return nil, "", false
 	}
 	typ = recv.Type()
 	if t, ok := typ.(*types.Pointer); ok {
@@ -1382,7 +1703,7 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 		}
 	} else if v := w.CheckIsBasic(cursor, pkgInfo); v != nil {
 		if w.findMode.Info {
-			w.cmd.Println(fmt.Sprintf("basic type %v (%v)", v.Kind, v.Value))
+			w.printText("info", fmt.Sprintf("basic type %v (%v)", v.Kind, v.Value))
 			return nil
 		}
 		return fmt.Errorf("not support basic type: %v (%v)", v.Kind, v.Value)
@@ -1410,6 +1731,9 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 	if cursorId == nil && cursorObj == nil {
 		return fmt.Errorf("not found object")
 	}
+	if w.findMode.Highlight {
+		return w.LookupHighlight(pkgInfo, cursor, cursorObj)
+	}
 
 	var findInfo *ObjectInfo
 	var cursorPkg *types.Package
@@ -1430,10 +1754,34 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 	}
 	if w.findMode.Info {
 		w.printInfo(cursorObj, kind, packageName, packagePath, findInfo)
+		if info := typeparams.Instance(pkgInfo, cursorObj, cursor.pos, w.qualifier); info != "" {
+			w.printText("info", info)
+		}
 	}
 	if w.findMode.Doc && w.findMode.Define {
 		w.printDoc(cursorPos)
 	}
+	if w.findMode.Rename != "" {
+		if findInfo.obj == nil {
+			return fmt.Errorf("cannot rename %s %s", kind, packageName)
+		}
+		return w.LookupRename(conf, findInfo.obj)
+	}
+	if w.findMode.Layout && findInfo.obj != nil {
+		return w.LookupLayout(conf, findInfo.obj)
+	}
+	if w.findMode.MethodSet && findInfo.obj != nil {
+		return w.LookupMethodSet(conf, findInfo.obj)
+	}
+	if w.findMode.TypeDef || w.findMode.Explain {
+		return w.LookupTypeDef(pkg, pkgInfo, cursor, cursorObj)
+	}
+	if (w.findMode.Callers || w.findMode.Callees) && findInfo.obj != nil {
+		return w.LookupCalls(conf, findInfo.obj)
+	}
+	if w.findMode.Implements && findInfo.obj != nil {
+		return w.LookupImplements(conf, findInfo.obj)
+	}
 
 	if !w.findMode.Usage {
 		return nil
@@ -1528,7 +1876,7 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 		usages = append(usages, int(cursorPos))
 	}
 
-	w.printUsages(usages)
+	w.printUsages(conf, usages)
 
 	//check look for current pkg.object on pkg_test
 	if w.findMode.UsageAll || IsSamePkg(cursorPkg, conf.Pkg) || IsSamePkg(cursorPkg, conf.XPkg) {
@@ -1553,7 +1901,7 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 			if importRange != nil {
 				w.printImportRange(importRange)
 			}
-			w.printUsages(usages)
+			w.printUsages(conf, usages)
 		}
 	}
 
@@ -1591,45 +1939,67 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 	if w.Mod == nil && pkgutil.IsVendorExperiment() {
 		findPkgPath = pkgutil.VendorPathToImportPath(findPkgPath)
 	}
-	// check on module dir
-	if w.Mod != nil {
-		dir := w.Mod.Root().Dir
-		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if !info.IsDir() {
-				return nil
-			}
-			if path != dir && info.Name() == "vendor" {
-				return filepath.SkipDir
-			}
-			if conf.Bpkg.Dir == path {
-				return nil
-			}
-			bp, err := w.importPath(dir, path, 0)
-			if err != nil {
-				return nil
-			}
-			if !bp.IsCommand() {
-				importPath := w.Mod.Root().Path
-				if path != dir {
-					importPath = filepath.Join(importPath, path[len(dir)+1:])
+	uses_paths = w.lookupUsesPaths(conf, kind, cursorPkg, findPkgPath, uses_paths)
+
+	//w.Imported = make(map[string]*types.Package)
+	for _, v := range uses_paths {
+		var usages []int
+		var importRange []ast.Expr
+		vpkg, conf, _ := w.Import("", v, NewPkgConfig(false, !typesSkipTests), nil)
+		if vpkg != nil && vpkg.Path() == packagePath && kind == ObjPkgName {
+			usages = append(usages, findPackageDef(packageName, conf.Files)...)
+		}
+		if vpkg != nil && vpkg != pkg {
+			if kind == ObjPackage || kind == ObjPkgName {
+				if conf.Info != nil {
+					usages = append(usages, findPackageUses(packagePath, conf.Files, conf.Info)...)
+					if w.findMode.ImportRange {
+						importRange = append(importRange, findPackageImportRange(packagePath, conf.Files)...)
+					} else if w.findMode.Import {
+						usages = append(usages, findPackageImports(packageName, packagePath, conf.Files)...)
+					}
 				}
-				if kind == ObjPackage && importPath == findPkgPath {
-					return nil
+				if conf.XInfo != nil {
+					usages = append(usages, findPackageUses(packagePath, conf.XTestFiles, conf.XInfo)...)
+					if w.findMode.ImportRange {
+						importRange = append(importRange, findPackageImportRange(packagePath, conf.XTestFiles)...)
+					} else if w.findMode.Import {
+						usages = append(usages, findPackageImports(packageName, packagePath, conf.XTestFiles)...)
+					}
 				}
-			}
-			if kind == ObjPkgName && bp.ImportPath == findPkgPath {
-				uses_paths = append(uses_paths, bp.ImportPath)
 			} else {
-				importPath := path
-				for _, v := range uses_paths {
-					if v == importPath {
-						return nil
-					}
+				if conf.Info != nil {
+					usages = append(usages, findObjectUses(cursorObj, kind, findInfo, conf.Info)...)
+				}
+				if conf.XInfo != nil {
+					usages = append(usages, findObjectUses(cursorObj, kind, findInfo, conf.XInfo)...)
 				}
-				uses_paths = append(uses_paths, importPath)
 			}
-			return nil
-		})
+		}
+		if v == find_def_pkg {
+			usages = append(usages, int(cursorPos))
+		}
+
+		if importRange != nil {
+			w.printImportRange(importRange)
+		}
+		w.printUsages(conf, usages)
+	}
+	return nil
+}
+
+// lookupUsesPaths appends the packages that may use findPkgPath to uses_paths:
+// the packages of the current module and the packages importing findPkgPath.
+func (w *PkgWalker) lookupUsesPaths(conf *PkgConfig, kind ObjKind, cursorPkg *types.Package, findPkgPath string, uses_paths []string) []string {
+	// check on the workspace modules and the local replace modules
+	if w.Mod != nil {
+		modules := w.Mod.LocalModules()
+		if w.findMode.ModCache {
+			modules = append(modules, w.Mod.CacheModules()...)
+		}
+		for _, m := range modules {
+			uses_paths = w.lookupModuleUsesPaths(conf, kind, m.Dir, findPkgPath, uses_paths)
+		}
 	}
 	ctx := *w.Context
 	searchAll := true
@@ -1681,80 +2051,76 @@ func (w *PkgWalker) LookupObjects(conf *PkgConfig, cursor *FileCursor) error {
 			}
 		})
 	}
+	return uses_paths
+}
 
-	//w.Imported = make(map[string]*types.Package)
-	for _, v := range uses_paths {
-		var usages []int
-		var importRange []ast.Expr
-		vpkg, conf, _ := w.Import("", v, NewPkgConfig(false, !typesSkipTests), nil)
-		if vpkg != nil && vpkg.Path() == packagePath && kind == ObjPkgName {
-			usages = append(usages, findPackageDef(packageName, conf.Files)...)
+// lookupModuleUsesPaths appends the import paths of the packages of the
+// module in dir to uses_paths. Nested modules and vendor are skipped.
+func (w *PkgWalker) lookupModuleUsesPaths(conf *PkgConfig, kind ObjKind, dir string, findPkgPath string, uses_paths []string) []string {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
 		}
-		if vpkg != nil && vpkg != pkg {
-			if kind == ObjPackage || kind == ObjPkgName {
-				if conf.Info != nil {
-					usages = append(usages, findPackageUses(packagePath, conf.Files, conf.Info)...)
-					if w.findMode.ImportRange {
-						importRange = append(importRange, findPackageImportRange(packagePath, conf.Files)...)
-					} else if w.findMode.Import {
-						usages = append(usages, findPackageImports(packageName, packagePath, conf.Files)...)
-					}
-				}
-				if conf.XInfo != nil {
-					usages = append(usages, findPackageUses(packagePath, conf.XTestFiles, conf.XInfo)...)
-					if w.findMode.ImportRange {
-						importRange = append(importRange, findPackageImportRange(packagePath, conf.XTestFiles)...)
-					} else if w.findMode.Import {
-						usages = append(usages, findPackageImports(packageName, packagePath, conf.XTestFiles)...)
-					}
-				}
-			} else {
-				if conf.Info != nil {
-					usages = append(usages, findObjectUses(cursorObj, kind, findInfo, conf.Info)...)
-				}
-				if conf.XInfo != nil {
-					usages = append(usages, findObjectUses(cursorObj, kind, findInfo, conf.XInfo)...)
-				}
+		if path != dir {
+			name := info.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
 			}
 		}
-		if v == find_def_pkg {
-			usages = append(usages, int(cursorPos))
+		if conf.Bpkg.Dir == path {
+			return nil
 		}
-
-		if importRange != nil {
-			w.printImportRange(importRange)
+		importPath, ok := w.Mod.ImportPath(path)
+		if !ok {
+			return nil
 		}
-		w.printUsages(usages)
-	}
-	return nil
+		bp, err := w.importPath(dir, path, 0)
+		if err != nil {
+			return nil
+		}
+		if kind == ObjPackage && !bp.IsCommand() && importPath == findPkgPath {
+			return nil
+		}
+		for _, v := range uses_paths {
+			if v == importPath {
+				return nil
+			}
+		}
+		uses_paths = append(uses_paths, importPath)
+		return nil
+	})
+	return uses_paths
 }
 
 func (w *PkgWalker) printInfo(cursorObj types.Object, kind ObjKind, packageName, packagePath string, findInfo *ObjectInfo) {
 	if kind == ObjBuiltin {
-		w.cmd.Println(builtinInfo(cursorObj.Name()))
+		w.printText("info", builtinInfo(cursorObj.Name()))
 	} else if kind == ObjPackage {
 		if packageName == packagePath {
-			w.cmd.Printf("package %s\n", packageName)
+			w.printText("info", fmt.Sprintf("package %s", packageName))
 		} else {
-			w.cmd.Printf("package %s (%q)\n", packageName, packagePath)
+			w.printText("info", fmt.Sprintf("package %s (%q)", packageName, packagePath))
 		}
 	} else if kind == ObjPkgName {
 		if packageName == packagePath {
-			w.cmd.Printf("package %s\n", packageName)
+			w.printText("info", fmt.Sprintf("package %s", packageName))
 		} else {
-			w.cmd.Printf("package %s (%q)\n", packageName, packagePath)
+			w.printText("info", fmt.Sprintf("package %s (%q)", packageName, packagePath))
 		}
 	} else if kind == ObjImplicit {
-		w.cmd.Printf("%s is implicit\n", cursorObj)
+		w.printText("info", fmt.Sprintf("%s is implicit", cursorObj))
 	} else if findInfo.isInterfaceMethod {
 		if findInfo.pkg == nil {
 			// error.Error()
-			w.cmd.Println(w.simpleObjInfo(findInfo.obj))
+			w.printText("info", w.simpleObjInfo(findInfo.obj))
 		} else {
-			w.cmd.Println(strings.Replace(w.simpleObjInfo(findInfo.obj), "(interface)", findInfo.pkg.Name()+"."+findInfo.interfaceTypeName, 1))
+			w.printText("info", strings.Replace(w.simpleObjInfo(findInfo.obj), "(interface)", findInfo.pkg.Name()+"."+findInfo.interfaceTypeName, 1))
 		}
 	} else {
-		w.cmd.Println(w.simpleObjInfo(cursorObj))
+		w.printText("info", w.simpleObjInfo(cursorObj))
 	}
 }
 
@@ -1775,12 +2141,12 @@ func (w *PkgWalker) printDefine(isImport bool, fname, fpath string, findInfo *Ob
 		}
 		bp, err := w.importPath("", findpath, build.FindOnly)
 		if err == nil {
-			w.cmd.Println(w.FileSet.Position(findInfo.pos).String() + "::" + fname + "::" + fpath + "::" + bp.Dir)
+			w.printImportPos(findInfo.pos, fname, fpath, bp.Dir)
 		} else {
-			w.cmd.Println(w.FileSet.Position(findInfo.pos))
+			w.printPos("def", findInfo.pos)
 		}
 	} else {
-		w.cmd.Println(w.FileSet.Position(findInfo.pos))
+		w.printPos("def", findInfo.pos)
 	}
 }
 
@@ -1801,21 +2167,25 @@ func (w *PkgWalker) printDoc(cursorPos token.Pos) {
 		}
 	}
 	if group != nil {
-		w.cmd.Println(group.Text())
+		w.printText("doc", group.Text())
 	}
 }
 
 func (w *PkgWalker) printImportRange(importRange []ast.Expr) {
 	sort.Sort(ExprSlice(importRange))
 	for _, expr := range importRange {
-		pos := w.FileSet.Position(expr.Pos() + 1)
-		w.cmd.Printf("%s:%d:%d-%d\n",
-			pos.Filename, pos.Line, pos.Column,
-			pos.Column+int(expr.End())-int(expr.Pos())-2)
+		pos := w.position(expr.Pos() + 1)
+		end := w.position(expr.End() - 1).Column
+		w.cmd.PrintResult(&Result{Kind: "usage", Filename: pos.Filename, Line: pos.Line, Column: pos.Column, EndLine: pos.Line, EndColumn: end},
+			fmt.Sprintf("%s:%d:%d-%d", pos.Filename, pos.Line, pos.Column, end))
 	}
 }
 
-func (w *PkgWalker) printUsages(usages []int) {
+func (w *PkgWalker) printUsages(conf *PkgConfig, usages []int) {
+	if w.findMode.Context {
+		w.printUsageContexts(conf, usages)
+		return
+	}
 	(sort.IntSlice(usages)).Sort()
 	var last int = -1
 	for _, pos := range usages {
@@ -1823,8 +2193,76 @@ func (w *PkgWalker) printUsages(usages []int) {
 			continue
 		}
 		last = pos
-		w.cmd.Println(w.FileSet.Position(token.Pos(pos)))
+		w.printPos("usage", token.Pos(pos))
+	}
+}
+
+// Result is the json output of one types result. Kind is one of
+// def, info, doc, usage, impl, edit, conflict, caller, callee, typedef,
+// explain, definition, read, write or package. With FindMode.Context a usage
+// has the package Path, the enclosing declaration Name and the line Text.
+type Result struct {
+	Kind      string `json:"kind"`
+	Filename  string `json:"filename,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Offset    int    `json:"offset,omitempty"`
+	Length    int    `json:"length,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Dir       string `json:"dir,omitempty"`
+	Def       string `json:"def,omitempty"`
+	Depth     int    `json:"depth,omitempty"`
+	Dynamic   bool   `json:"dynamic,omitempty"`
+	Test      bool   `json:"test,omitempty"`
+}
+
+// position returns the position of p with the column and offset counting
+// units of w.PosEncoding.
+func (w *PkgWalker) position(p token.Pos) token.Position {
+	return w.posConv.Position(w.FileSet.Position(p))
+}
+
+// positionRange returns the start and end positions of the token at p. The
+// end position is invalid if the source of the token is not found.
+func (w *PkgWalker) positionRange(p token.Pos) (token.Position, token.Position) {
+	return w.posConv.Range(w.FileSet.Position(p))
+}
+
+// posText returns the text of a result position, followed by -column or
+// -line:column of the end position if FindMode.End is set.
+func (w *PkgWalker) posText(pos, end token.Position) string {
+	text := pos.String()
+	if !w.findMode.End || !end.IsValid() {
+		return text
+	}
+	if end.Line == pos.Line {
+		return fmt.Sprintf("%s-%d", text, end.Column)
 	}
+	return fmt.Sprintf("%s-%d:%d", text, end.Line, end.Column)
+}
+
+func (w *PkgWalker) posResult(kind string, p token.Pos) *Result {
+	pos, end := w.positionRange(p)
+	return &Result{Kind: kind, Filename: pos.Filename, Line: pos.Line, Column: pos.Column,
+		EndLine: end.Line, EndColumn: end.Column}
+}
+
+func (w *PkgWalker) printPos(kind string, p token.Pos) {
+	w.cmd.PrintResult(w.posResult(kind, p), w.posText(w.positionRange(p)))
+}
+
+func (w *PkgWalker) printImportPos(p token.Pos, name, path, dir string) {
+	r := w.posResult("def", p)
+	r.Name, r.Path, r.Dir = name, path, dir
+	w.cmd.PrintResult(r, w.posText(w.positionRange(p))+"::"+name+"::"+path+"::"+dir)
+}
+
+func (w *PkgWalker) printText(kind string, text string) {
+	w.cmd.PrintResult(&Result{Kind: kind, Text: text}, text)
 }
 
 func findObjectUses(cursorObj types.Object, kind ObjKind, findInfo *ObjectInfo, pkgInfo *types.Info) (usages []int) {
@@ -2024,7 +2462,7 @@ func (w *PkgWalker) CheckObjectInfo(cursorObj types.Object, cursorSelection *typ
 		}
 	}
 	if cursorPkg != nil && cursorPkg != pkg &&
-		kind != ObjPkgName && w.isBinaryPkg(cursorPkg.Path()) {
+		kind != ObjPkgName && w.fromExportData(cursorPkg) {
 		pkg, conf, _ := w.Import("", cursorPkg.Path(), NewPkgConfig(true, !typesSkipTests), nil)
 		if pkg != nil {
 			if cursorIsInterfaceMethod {
@@ -12,15 +12,13 @@ const enableTypeParams = false
 
 func DefaultPkgConfig() *PkgConfig {
 	conf := &PkgConfig{IgnoreFuncBodies: false, AllowBinary: true, WithTestFiles: true}
-	conf.Info = &types.Info{
-		Uses:       make(map[*ast.Ident]types.Object),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Scopes:     make(map[ast.Node]*types.Scope),
-		Implicits:  make(map[ast.Node]types.Object),
-	}
-	conf.XInfo = &types.Info{
+	conf.Info = newInfo()
+	conf.XInfo = newInfo()
+	return conf
+}
+
+func newInfo() *types.Info {
+	return &types.Info{
 		Uses:       make(map[*ast.Ident]types.Object),
 		Defs:       make(map[*ast.Ident]types.Object),
 		Selections: make(map[*ast.SelectorExpr]*types.Selection),
@@ -28,9 +26,33 @@ func DefaultPkgConfig() *PkgConfig {
 		Scopes:     make(map[ast.Node]*types.Scope),
 		Implicits:  make(map[ast.Node]types.Object),
 	}
-	return conf
 }
 
 func sameNamed(n1, n2 *types.Named) bool {
 	return n1 == n2
 }
+
+func isGenericType(typ types.Type) bool {
+	return false
+}
+
+// unindex returns the function of an index expression.
+func unindex(expr ast.Expr) ast.Expr {
+	if e, ok := expr.(*ast.IndexExpr); ok {
+		return e.X
+	}
+	return expr
+}
+
+// uninstance returns expr, there are no instantiations.
+func uninstance(info *types.Info, expr ast.Expr) ast.Expr {
+	return expr
+}
+
+func typeParamNames(named *types.Named) string {
+	return ""
+}
+
+func typeParamsDecl(named *types.Named, q types.Qualifier) string {
+	return ""
+}
@@ -6,22 +6,20 @@ package types
 import (
 	"go/ast"
 	"go/types"
+	"strings"
 )
 
 const enableTypeParams = true
 
 func DefaultPkgConfig() *PkgConfig {
 	conf := &PkgConfig{IgnoreFuncBodies: false, AllowBinary: true, WithTestFiles: true}
-	conf.Info = &types.Info{
-		Uses:       make(map[*ast.Ident]types.Object),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Scopes:     make(map[ast.Node]*types.Scope),
-		Implicits:  make(map[ast.Node]types.Object),
-		Instances:  make(map[*ast.Ident]types.Instance),
-	}
-	conf.XInfo = &types.Info{
+	conf.Info = newInfo()
+	conf.XInfo = newInfo()
+	return conf
+}
+
+func newInfo() *types.Info {
+	return &types.Info{
 		Uses:       make(map[*ast.Ident]types.Object),
 		Defs:       make(map[*ast.Ident]types.Object),
 		Selections: make(map[*ast.SelectorExpr]*types.Selection),
@@ -30,9 +28,71 @@ func DefaultPkgConfig() *PkgConfig {
 		Implicits:  make(map[ast.Node]types.Object),
 		Instances:  make(map[*ast.Ident]types.Instance),
 	}
-	return conf
 }
 
 func sameNamed(n1, n2 *types.Named) bool {
 	return n1 != nil && n2 != nil && n1.Origin().String() == n2.Origin().String()
 }
+
+func isGenericType(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	return ok && named.TypeParams().Len() > 0
+}
+
+// unindex returns the function of an explicit instantiation f[T] or f[T, U].
+func unindex(expr ast.Expr) ast.Expr {
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		return e.X
+	case *ast.IndexListExpr:
+		return e.X
+	}
+	return expr
+}
+
+// uninstance returns the generic function of an explicit instantiation
+// f[T] or f[T, U]. Other index expressions, as fs[0] of a slice of funcs,
+// are returned unchanged.
+func uninstance(info *types.Info, expr ast.Expr) ast.Expr {
+	x := unindex(expr)
+	var id *ast.Ident
+	switch x := x.(type) {
+	case *ast.Ident:
+		id = x
+	case *ast.SelectorExpr:
+		id = x.Sel
+	}
+	if _, ok := info.Instances[id]; ok {
+		return x
+	}
+	return expr
+}
+
+// typeParamNames returns the type parameters of the generic type named as
+// [T, U] for a method receiver, or "".
+func typeParamNames(named *types.Named) string {
+	tparams := named.TypeParams()
+	if tparams.Len() == 0 {
+		return ""
+	}
+	var list []string
+	for i := 0; i < tparams.Len(); i++ {
+		list = append(list, tparams.At(i).Obj().Name())
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+// typeParamsDecl returns the type parameters of the generic type named with
+// their constraints as [K comparable, V any], or "".
+func typeParamsDecl(named *types.Named, q types.Qualifier) string {
+	tparams := named.TypeParams()
+	if tparams.Len() == 0 {
+		return ""
+	}
+	var list []string
+	for i := 0; i < tparams.Len(); i++ {
+		tp := tparams.At(i)
+		list = append(list, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), q))
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
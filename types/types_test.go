@@ -1,10 +1,20 @@
 package types
 
 import (
+	"bytes"
 	"fmt"
 	"go/build"
+	"go/types"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/pkgcache"
+	"github.com/visualfc/gotools/pkg/srcpos"
 )
 
 func TestTypes(t *testing.T) {
@@ -13,7 +23,7 @@ func TestTypes(t *testing.T) {
 	w.SetFindMode(&FindMode{Info: true, Doc: true, Define: true})
 	conf := DefaultPkgConfig()
 	dir, _ := os.Getwd()
-	cursor := NewFileCursor(nil, dir, "types_test.go", 126)
+	cursor := NewFileCursor(nil, dir, "types_test.go", 327)
 	pkg, conf, err := w.Check(dir, conf, cursor)
 	if err != nil {
 		t.Fatalf("error %v\n", err)
@@ -32,7 +42,7 @@ func TestError(t *testing.T) {
 	w.SetFindMode(&FindMode{Info: true, Doc: true, Define: true, Usage: true, UsageAll: true})
 	conf := DefaultPkgConfig()
 	dir, _ := os.Getwd()
-	cursor := NewFileCursor(nil, dir, "types_test.go", 530)
+	cursor := NewFileCursor(nil, dir, "types_test.go", 730)
 	pkg, conf, err := w.Check(dir, conf, cursor)
 	if err != nil {
 		t.Fatalf("error %v\n", err)
@@ -61,3 +71,1235 @@ func TestOS(t *testing.T) {
 		fn2()
 	}
 }
+
+// sourceCheck is a package of test sources in a temporary directory.
+type sourceCheck struct {
+	files  map[string]string
+	dir    string
+	w      *PkgWalker
+	pkg    *types.Package
+	conf   *PkgConfig
+	err    error
+	cursor *FileCursor
+	out    bytes.Buffer
+}
+
+// newSourceCheck writes files, slash separated file names mapped to
+// sources, to a temporary directory that must be removed with remove, and
+// returns it with a new walker of the default build context.
+func newSourceCheck(t *testing.T, files map[string]string) *sourceCheck {
+	dir, err := ioutil.TempDir("", "types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &sourceCheck{files: map[string]string{}, dir: dir, w: NewPkgWalker(&build.Default)}
+	c.w.SetOutput(&c.out, os.Stderr)
+	for name, src := range files {
+		c.write(t, name, src)
+	}
+	return c
+}
+
+// write writes the file name of the directory.
+func (c *sourceCheck) write(t *testing.T, name string, src string) {
+	filename := c.path(name)
+	os.MkdirAll(filepath.Dir(filename), 0755)
+	if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+		c.remove()
+		t.Fatal(err)
+	}
+	c.files[name] = src
+}
+
+// path returns the file name of the slash separated name of the directory.
+func (c *sourceCheck) path(name string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(name))
+}
+
+// check type-checks the package of the file of pos, or of the directory if
+// pos is "", with its test files in find mode mode. The cursor is at pos, a
+// file name and the text at the cursor as "a.go:text", at the | of the text
+// if it has one, or the line and column as "a.go:6:36", at the start of the
+// file if pos is a file name and none if pos is "". The test fails if no
+// package is checked, type errors are kept in err.
+func (c *sourceCheck) check(t *testing.T, pos string, mode *FindMode) {
+	if mode != nil {
+		c.w.SetFindMode(mode)
+	}
+	dir := c.dir
+	c.cursor = nil
+	if pos != "" {
+		name, at := pos, ""
+		if i := strings.Index(pos, ":"); i >= 0 {
+			name, at = pos[:i], pos[i+1:]
+		}
+		dir = filepath.Dir(c.path(name))
+		var line, column int
+		if n, _ := fmt.Sscanf(at, "%d:%d", &line, &column); n == 2 && fmt.Sprintf("%d:%d", line, column) == at {
+			c.cursor = NewFileCursor(nil, dir, filepath.Base(name), 0)
+			c.cursor.SetLineColumn(line, column)
+		} else {
+			mark := strings.Index(at, "|")
+			if mark < 0 {
+				mark = 0
+			}
+			offset := strings.Index(c.files[name], strings.Replace(at, "|", "", 1))
+			if offset < 0 {
+				c.remove()
+				t.Fatalf("%v not found", pos)
+			}
+			c.cursor = NewFileCursor(nil, dir, filepath.Base(name), offset+mark)
+		}
+	}
+	c.pkg, c.conf, c.err = c.w.Check(dir, DefaultPkgConfig(), c.cursor)
+	if c.conf == nil {
+		c.remove()
+		t.Fatal(c.err)
+	}
+}
+
+// lookup looks up the cursor and returns the output with the directory
+// trimmed from file names.
+func (c *sourceCheck) lookup() (string, error) {
+	c.out.Reset()
+	err := c.w.LookupCursor(c.pkg, c.conf, c.cursor)
+	return strings.Replace(c.out.String(), c.dir+string(filepath.Separator), "", -1), err
+}
+
+func (c *sourceCheck) remove() {
+	os.RemoveAll(c.dir)
+}
+
+// checkSource writes files to a temporary directory and type-checks its
+// package with the cursor at pos in find mode mode, see sourceCheck.check.
+func checkSource(t *testing.T, files map[string]string, pos string, mode *FindMode) *sourceCheck {
+	c := newSourceCheck(t, files)
+	c.check(t, pos, mode)
+	return c
+}
+
+var implSource = `package impl
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ n float64 }
+
+func (s Square) Area() float64 { return s.n * s.n }
+
+type Circle struct{ r float64 }
+
+func (c *Circle) Area() float64 { return 3 * c.r * c.r }
+
+type Line struct{}
+`
+
+func TestImplements(t *testing.T) {
+	for _, test := range []struct{ pos, want string }{
+		{"impl.go:Shape interface", "impl.go:7:6\nimpl.go:11:6\n"},
+		{"impl.go:Area() float64\n}", "impl.go:9:17\nimpl.go:13:18\n"},
+		{"impl.go:Circle struct", "impl.go:3:6\n"},
+		{"impl.go:Line struct", ""},
+	} {
+		c := checkSource(t, map[string]string{"impl.go": implSource}, test.pos, &FindMode{Implements: true})
+		got, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
+
+var renameShapeSource = `package shape
+
+type Shape interface {
+	Area() float64
+}
+
+type Base struct {
+	Name string
+}
+
+type Square struct {
+	Base
+	N float64
+}
+
+func (s Square) Area() float64 { return s.N * s.N }
+
+func Total(list []Shape) (n float64) {
+	for _, s := range list {
+		n += s.Area()
+	}
+	return
+}
+`
+
+var renameMainSource = `package main
+
+import "example.com/rename/shape"
+
+func main() {
+	sq := shape.Square{N: 2}
+	sq.Name = "square"
+	println(sq.Area(), shape.Total([]shape.Shape{sq}))
+}
+`
+
+func TestRename(t *testing.T) {
+	rename := func(text string, newName string, write bool) (*sourceCheck, string, error) {
+		c := checkSource(t, map[string]string{
+			"go.mod":         "module example.com/rename\n",
+			"shape/shape.go": renameShapeSource,
+			"main.go":        renameMainSource,
+		}, "shape/shape.go:"+text, &FindMode{Rename: newName, Write: write})
+		out, err := c.lookup()
+		return c, out, err
+	}
+	checkFile := func(c *sourceCheck, name string, want string) {
+		data, _ := ioutil.ReadFile(c.path(name))
+		if string(data) != want {
+			c.remove()
+			t.Fatalf("%s: got\n%s\nwant\n%s", name, data, want)
+		}
+	}
+
+	c, out, err := rename("Area() float64\n}", "Size", false)
+	c.remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out, "::Size\n"); n != 4 {
+		t.Fatalf("got %v edits\n%s", n, out)
+	}
+	c, _, err = rename("Area() float64\n}", "Size", true)
+	if err != nil {
+		c.remove()
+		t.Fatal(err)
+	}
+	checkFile(c, "shape/shape.go", strings.Replace(renameShapeSource, "Area()", "Size()", -1))
+	checkFile(c, "main.go", strings.Replace(renameMainSource, "Area()", "Size()", -1))
+	c.remove()
+
+	c, _, err = rename("Name string", "Title", true)
+	if err != nil {
+		c.remove()
+		t.Fatal(err)
+	}
+	checkFile(c, "shape/shape.go", strings.Replace(renameShapeSource, "Name", "Title", -1))
+	checkFile(c, "main.go", strings.Replace(renameMainSource, "sq.Name", "sq.Title", -1))
+	c.remove()
+
+	for _, test := range []struct{ text, newName, conflict string }{
+		{"N float64", "Base", "Square already has field Base"},
+		{"Area() float64 {", "N", "Square already has field N"},
+		{"Name string", "title", "Name is used by package example.com/rename, title would be unexported"},
+		{"n float64) {", "list", "n list conflicts with var list"},
+		{"s := range", "n", "would be shadowed by renamed var s"},
+	} {
+		c, out, err := rename(test.text, test.newName, true)
+		if err == nil || !strings.Contains(out, test.conflict) {
+			c.remove()
+			t.Fatalf("%s: %v\n%s", test.text, err, out)
+		}
+		checkFile(c, "shape/shape.go", renameShapeSource)
+		c.remove()
+	}
+}
+
+var callsSource = `package calls
+
+type Shape interface{ Area() float64 }
+
+type Square struct{ n float64 }
+
+func (s Square) Area() float64 { return mul(s.n, s.n) }
+
+func mul(a, b float64) float64 { return a * b }
+
+func total(list []Shape) (n float64) {
+	for _, s := range list {
+		n += s.Area()
+	}
+	return
+}
+
+func run() float64 {
+	return total([]Shape{Square{2}}) + Square{1}.Area()
+}
+`
+
+func TestCalls(t *testing.T) {
+	for _, test := range []struct {
+		pos  string
+		mode *FindMode
+		want string
+	}{
+		{"calls.go:Area() float64 {", &FindMode{Callers: true, Depth: 2}, "" +
+			"calls.go:13:10::calls.total::calls.go:11:6::dynamic\n" +
+			"\tcalls.go:19:9::calls.run::calls.go:18:6\n" +
+			"calls.go:19:47::calls.run::calls.go:18:6\n"},
+		{"calls.go:run()", &FindMode{Callees: true, Depth: 2}, "" +
+			"calls.go:19:9::calls.total::calls.go:11:6\n" +
+			"\tcalls.go:13:10::calls.Shape.Area::calls.go:3:23::dynamic\n" +
+			"calls.go:19:47::calls.Square.Area::calls.go:7:17\n" +
+			"\tcalls.go:7:41::calls.mul::calls.go:9:6\n"},
+	} {
+		c := checkSource(t, map[string]string{"calls.go": callsSource}, test.pos, test.mode)
+		got, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
+
+func TestCallersOfCallers(t *testing.T) {
+	defer os.Setenv("GO111MODULE", os.Getenv("GO111MODULE"))
+	os.Setenv("GO111MODULE", "off")
+	// outside of modules only the packages importing the package of a
+	// function are searched for its callers, c imports only b
+	c := newSourceCheck(t, map[string]string{
+		"src/a/a.go": "package a\n\nfunc A() {}\n",
+		"src/b/b.go": "package b\n\nimport \"a\"\n\nfunc B() { a.A() }\n",
+		"src/c/c.go": "package c\n\nimport \"b\"\n\nfunc C() { b.B() }\n",
+	})
+	defer c.remove()
+	ctx := build.Default
+	ctx.GOPATH = c.dir
+	c.w.Context = &ctx
+	c.check(t, "src/a/a.go:A()", &FindMode{Callers: true, Depth: 2, UsageAll: true})
+	got, err := c.lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "src/b/b.go:5:14::b.B::src/b/b.go:5:6\n" +
+		"\tsrc/c/c.go:5:14::c.C::src/c/c.go:5:6\n"
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// the callers of a method through an interface are searched in the
+	// packages importing the package of the interface, e imports only d
+	c.write(t, "src/d/d.go", "package d\n\ntype Shape interface{ Area() int }\n")
+	c.write(t, "src/s/s.go", "package s\n\nimport \"d\"\n\ntype Square struct{}\n\nfunc (Square) Area() int { return 0 }\n\nvar _ d.Shape = Square{}\n")
+	c.write(t, "src/e/e.go", "package e\n\nimport \"d\"\n\nfunc E(x d.Shape) int { return x.Area() }\n")
+	c.check(t, "src/s/s.go:Area()", nil)
+	if got, err = c.lookup(); err != nil {
+		t.Fatal(err)
+	}
+	if want = "src/e/e.go:5:34::e.E::src/e/e.go:5:6::dynamic\n"; got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestModCacheUsages(t *testing.T) {
+	for _, env := range [][2]string{{"GOFLAGS", ""}, {"GOWORK", "off"}, {"GOPROXY", "off"}, {"GOMODCACHE", ""}} {
+		defer os.Setenv(env[0], os.Getenv(env[0]))
+		os.Setenv(env[0], env[1])
+	}
+	// example.com/lib of the module cache uses example.com/m/api, go.sum has
+	// the hash of its go.mod and the zip hash of the cache
+	cache := "gopath/pkg/mod/cache/download/example.com/lib/@v/v1.0.0"
+	lib := "gopath/pkg/mod/example.com/lib@v1.0.0"
+	c := newSourceCheck(t, map[string]string{
+		cache + ".mod":        "module example.com/lib\n",
+		cache + ".info":       `{"Version":"v1.0.0"}`,
+		cache + ".ziphash":    "h1:lib",
+		lib + "/go.mod":       "module example.com/lib\n",
+		lib + "/util/util.go": "package util\n\nimport \"example.com/m/api\"\n\nfunc Use() { api.Do() }\n",
+		"m/go.mod":            "module example.com/m\n\ngo 1.16\n\nrequire example.com/lib v1.0.0\n",
+		"m/go.sum": "example.com/lib v1.0.0 h1:lib\n" +
+			"example.com/lib v1.0.0/go.mod h1:4OAnUP7RpKJ0hg7ydNi+A/luktLxx7xSrw0c+FeAtlc=\n",
+		"m/api/api.go": "package api\n\nfunc Do() {}\n",
+	})
+	defer c.remove()
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", c.path("gopath"))
+	ctx := build.Default
+	ctx.GOPATH = c.path("gopath")
+	c.w.Context = &ctx
+	for _, test := range []struct {
+		modcache bool
+		want     string
+	}{
+		{false, "m/api/api.go:3:6\n"},
+		{true, "m/api/api.go:3:6\n" + lib + "/util/util.go:5:18\n"},
+	} {
+		c.check(t, "m/api/api.go:Do()", &FindMode{Usage: true, UsageAll: true, SkipGoroot: true, ModCache: test.modcache})
+		got, err := c.lookup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("modcache %v: got\n%s\nwant\n%s", test.modcache, got, test.want)
+		}
+	}
+}
+
+var completeSource = `package complete
+
+type Base struct {
+	// ID is the identifier.
+	ID int
+}
+
+func (b *Base) Reset() {}
+
+type User struct {
+	Base
+	Name string
+}
+
+func run() {
+	count := 1
+	u := &User{Name: "", }
+	u.
+}
+`
+
+func TestComplete(t *testing.T) {
+	for _, test := range []struct {
+		pos  string
+		want string
+		text string // the text output of the third candidate
+	}{
+		{"complete.go:u.|", "field Base Base; field Name string; field ID int; method Reset func()", `field,,ID,,int,,ID is the identifier.\n`},
+		{`complete.go:Name: "", |`, "field Base Base", ""},
+		{"complete.go:\tu := &User{Name: \"\", }\n\t|", "var count int; var u *User; struct Base struct; struct User struct", "struct,,Base,,struct,,"},
+	} {
+		c := checkSource(t, map[string]string{"complete.go": completeSource}, test.pos, &FindMode{Doc: true})
+		_, list, err := c.w.LookupCompletions(c.conf, c.cursor)
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []string
+		for _, c := range list {
+			items = append(items, c.Kind+" "+c.Label+" "+c.Detail)
+			if len(items) == 4 {
+				break
+			}
+		}
+		if got := strings.Join(items, "; "); got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+		if test.text != "" {
+			if got := list[2].String(); got != test.text {
+				t.Fatalf("%s: got %q want %q", test.pos, got, test.text)
+			}
+		}
+	}
+}
+
+func TestModulePackages(t *testing.T) {
+	c := newSourceCheck(t, map[string]string{
+		"a/a.go":        "package a\n",
+		"cmd/x/main.go": "package main\n",
+	})
+	defer c.remove()
+
+	EnableWalkerCache(true)
+	defer EnableWalkerCache(false)
+	w := LookupPkgWalker(&build.Default)
+	check := func(name string, want string) {
+		if got := strings.Join(w.modulePackages(c.dir, "example.com/m").byName[name], " "); got != want {
+			t.Fatalf("%v: got %q want %q", name, got, want)
+		}
+	}
+	check("a", "example.com/m/a")
+	check("main", "")
+	// the list is kept until a file of a new package directory is invalidated
+	c.write(t, "b/b.go", "package a\n")
+	check("a", "example.com/m/a")
+	InvalidateCache(c.path("a/a.go"))
+	check("a", "example.com/m/a")
+	InvalidateCache(c.path("b/b.go"))
+	check("a", "example.com/m/a example.com/m/b")
+}
+
+var signatureSource = `package signature
+
+type Celsius float64
+
+// Map returns the results of f applied to the elements of s.
+func Map[T, U any](s []T, f func(T) U) []U {
+	var r []U
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+type Printer struct{}
+
+// Print prints the values.
+func (p *Printer) Print(
+	prefix string, // the line prefix
+	values ...interface{},
+) (n int, err error) {
+	return
+}
+
+func run() {
+	var p Printer
+	print := p.Print
+	print("a", 1, 2)
+	p.Print("a", 1, 2)
+	format := func(v int) string { return "" }
+	Map([]int{1}, format)
+	_ = Celsius(1)
+	copy([]byte{}, "go")
+	fs := []func(n int) int{}
+	fs[0](1)
+	Map[int, string]([]int{1}, format)
+}
+`
+
+func TestSignature(t *testing.T) {
+	if !enableTypeParams {
+		t.Skip("type parameters not supported")
+	}
+	for _, test := range []struct{ pos, want string }{
+		{`signature.go:print("a", 1,|`, "func print(prefix string, values ...interface{}) (n int, err error)\n1\n" +
+			"prefix string\nvalues ...interface{}\n"},
+		{`signature.go:p.Print("a", 1, 2|`, "func Print(prefix string, values ...interface{}) (n int, err error)\n1\n" +
+			"prefix string\t// the line prefix\nvalues ...interface{}\nPrint prints the values.\n"},
+		{"signature.go:Map([]int{1}, |", "func Map[T int, U string](s []int, f func(int) string) []string\n1\n" +
+			"s []int\nf func(int) string\nMap returns the results of f applied to the elements of s.\n"},
+		{"signature.go:r = append(r, f(|", "func f(T) U\n0\nT\n"},
+		{"signature.go:Celsius(|", "Celsius(x)\n0\nx Celsius\n"},
+		{"signature.go:copy([]byte{}, |", "func copy(dst, src []Type) int\n1\ndst []Type\nsrc []Type\n"},
+		{"signature.go:fs[0](|", "func fs[0](n int) int\n0\nn int\n"},
+		{"signature.go:Map[int, string]([]int{1}, |", "func Map[T int, U string](s []int, f func(int) string) []string\n1\n" +
+			"s []int\nf func(int) string\nMap returns the results of f applied to the elements of s.\n"},
+	} {
+		c := checkSource(t, map[string]string{"signature.go": signatureSource}, test.pos, &FindMode{Signature: true, Doc: true})
+		got, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
+
+var layoutSource = `package layout
+
+type T struct {
+	// a flag
+	a bool
+	b int64 // b value
+	c bool
+}
+
+type (
+	U struct {
+		// flags
+		a, b bool
+		c    int64
+		d    bool
+	}
+)
+
+var  x   = 1
+`
+
+func TestLayout(t *testing.T) {
+	c := newSourceCheck(t, map[string]string{"layout.go": layoutSource})
+	defer c.remove()
+	check := func(name string, mode *FindMode, want string) {
+		c.check(t, "layout.go:"+name+" struct", mode)
+		got, err := c.lookup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("got\n%s\nwant\n%s", got, want)
+		}
+	}
+	check("T", &FindMode{Layout: true, GOARCH: "386"}, `T: size 16, align 4, padding 6 (386)
+	a bool: offset 0, size 1, align 1, padding 3
+	b int64: offset 4, size 8, align 4, padding 0
+	c bool: offset 12, size 1, align 1, padding 3
+optimal order: b, a, c: size 12
+`)
+	check("T", &FindMode{Layout: true, GOARCH: "amd64", Write: true}, `T: size 24, align 8, padding 14 (amd64)
+	a bool: offset 0, size 1, align 1, padding 7
+	b int64: offset 8, size 8, align 8, padding 0
+	c bool: offset 16, size 1, align 1, padding 7
+optimal order: b, a, c: size 16
+`)
+	// fields declared together stay together, the rest of the file is kept
+	check("U", &FindMode{Layout: true, GOARCH: "amd64", Write: true}, `U: size 24, align 8, padding 13 (amd64)
+	a bool: offset 0, size 1, align 1, padding 0
+	b bool: offset 1, size 1, align 1, padding 6
+	c int64: offset 8, size 8, align 8, padding 0
+	d bool: offset 16, size 1, align 1, padding 7
+optimal order: c, a, b, d: size 16
+`)
+	data, _ := ioutil.ReadFile(c.path("layout.go"))
+	want := `package layout
+
+type T struct {
+	b int64 // b value
+	// a flag
+	a bool
+	c bool
+}
+
+type (
+	U struct {
+		c int64
+		// flags
+		a, b bool
+		d    bool
+	}
+)
+
+var  x   = 1
+`
+	if string(data) != want {
+		t.Fatalf("got\n%s\nwant\n%s", data, want)
+	}
+
+	// the fields declared together are split when put apart
+	g := checkSource(t, map[string]string{"group.go": "package group\n\ntype V struct {\n\t// flags\n\ta, b bool // a and b\n\tc    int16\n}\n"}, "group.go", nil)
+	defer g.remove()
+	if err := g.w.writeLayout(g.pkg.Scope().Lookup("V"), []int{0, 2, 1}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(g.path("group.go"))
+	if want = "package group\n\ntype V struct {\n\t// flags\n\ta bool // a and b\n\tc int16\n\tb bool\n}\n"; string(data) != want {
+		t.Fatalf("got\n%s\nwant\n%s", data, want)
+	}
+}
+
+var diagnosticsSource = `package diag
+
+import "fmt"
+
+func F() {
+	x := 1
+	var s string = 2
+}
+`
+
+func TestDiagnostics(t *testing.T) {
+	c := checkSource(t, map[string]string{
+		"diag.go":  diagnosticsSource,
+		"parse.go": "package diag\n\nvar = 1\n",
+	}, "", nil)
+	defer c.remove()
+	var list []string
+	for _, d := range c.w.Diagnostics(c.conf) {
+		list = append(list, fmt.Sprintf("%v:%v:%v-%v:%v %v", filepath.Base(d.Filename), d.Line, d.Column, d.EndLine, d.EndColumn, d.Severity))
+	}
+	want := []string{
+		"diag.go:3:8-3:13 warning",
+		"diag.go:6:2-6:3 warning",
+		"diag.go:7:6-7:7 warning",
+		"diag.go:7:17-7:18 error",
+		"parse.go:3:5-3:5 error",
+		"parse.go:3:7-3:7 error",
+	}
+	if got := strings.Join(list, "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("got\n%v\nwant\n%v", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestExportCache(t *testing.T) {
+	c := newSourceCheck(t, map[string]string{
+		"go.mod":     "module example.com/export\n",
+		"dep/dep.go": "package dep\n\nfunc Up(s string) string { return s }\n",
+		"main.go":    "package main\n\nimport \"example.com/export/dep\"\n\nvar s string = dep.Up(\"x\")\n",
+	})
+	defer c.remove()
+	cache := &pkgcache.Cache{Dir: c.path("cache")}
+
+	check := func() (*PkgWalker, *PkgConfig) {
+		c.w = NewPkgWalker(&build.Default)
+		c.w.SetOutput(&c.out, os.Stderr)
+		c.w.ExportCache = cache
+		c.check(t, "", nil)
+		return c.w, c.conf
+	}
+	fromCache := func(w *PkgWalker) bool {
+		_, ok := w.exportPkgs[w.Imported["example.com/export/dep"]]
+		return ok
+	}
+	if w, _ := check(); fromCache(w) {
+		t.Fatal("dep loaded from empty cache")
+	}
+	if s, _ := cache.Stats(); s.Entries != 1 {
+		t.Fatalf("got %v cache entries, want 1", s.Entries)
+	}
+	w, conf := check()
+	if !fromCache(w) || len(conf.Errors) > 0 {
+		t.Fatalf("dep not loaded from cache: %v", conf.Errors)
+	}
+
+	c.write(t, "dep/dep.go", "package dep\n\nfunc Up(s string) int { return 0 }\n")
+	w, conf = check()
+	if fromCache(w) || len(conf.Errors) != 1 {
+		t.Fatalf("stale cache entry used: %v", conf.Errors)
+	}
+	if err := cache.Clean(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := cache.Stats(); s.Entries != 0 {
+		t.Fatalf("got %v cache entries after clean", s.Entries)
+	}
+}
+
+func TestStaleImports(t *testing.T) {
+	// one walker, as kept by the walker cache between requests
+	c := newSourceCheck(t, map[string]string{
+		"go.mod":     "module example.com/stale\n",
+		"dep/dep.go": "package dep\n\nfunc Up() string { return \"\" }\n",
+		"mid/mid.go": "package mid\n\nimport \"example.com/stale/dep\"\n\nvar Mid = dep.Up()\n",
+		"main.go":    "package main\n\nimport \"example.com/stale/mid\"\n\nvar X = mid.Mid\n",
+	})
+	defer c.remove()
+	c.w.ExportCache = nil
+	typeOfX := func() string {
+		c.check(t, "", nil)
+		if c.pkg == nil {
+			t.Fatal(c.err)
+		}
+		return c.pkg.Scope().Lookup("X").Type().String()
+	}
+	if got := typeOfX(); got != "string" {
+		t.Fatalf("got %v, want string", got)
+	}
+	c.write(t, "dep/dep.go", "package dep\n\nfunc Up() int { return 0 }\n")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(c.path("dep/dep.go"), later, later)
+	if got := typeOfX(); got != "int" {
+		t.Fatalf("got %v after changing an indirect import, want int", got)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	c := newSourceCheck(t, map[string]string{
+		"a.go": "package ov\n\nfunc A() int { return 1 }\n",
+		"c.go": "package ov\n\nvar c = undefined\n",
+	})
+	defer c.remove()
+
+	archive := "-- a.go --\npackage ov\n\nfunc A() int { return B() }\n-- b.go --\npackage ov\n\nfunc B() int { return 2 }\n"
+	ov, err := buildctx.ParseOverlay([]byte(archive), c.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ov[c.path("c.go")] = nil
+	buildctx.SetOverlay(ov)
+	defer buildctx.SetOverlay(nil)
+
+	for filename, data := range ov {
+		if data != nil {
+			c.w.UpdateSourceData(filename, data, false)
+		}
+	}
+	c.check(t, "", nil)
+	if len(c.conf.Errors) > 0 {
+		t.Fatalf("overlay errors: %v", c.conf.Errors)
+	}
+	if c.pkg.Scope().Lookup("B") == nil {
+		t.Fatal("overlay file b.go not checked")
+	}
+
+	// the buffers of a finished request are not seen by the next one
+	c.w.ClearSourceData()
+	buildctx.SetOverlay(nil)
+	c.check(t, "", nil)
+	if len(c.conf.Errors) != 1 || !strings.Contains(c.conf.Errors[0].Error(), "undefined: undefined") {
+		t.Fatalf("overlay source data kept after ClearSourceData: %v", c.conf.Errors)
+	}
+}
+
+var posEncodingSource = `package pe
+
+// 中文注释 😀
+var 变量 = 1
+
+func F() int { /* 日本 */ return 变量 }
+`
+
+func TestPosEncoding(t *testing.T) {
+	for _, test := range []struct {
+		enc          srcpos.Encoding
+		line, column int
+		want         string
+	}{
+		{srcpos.Byte, 6, 36, "a.go:4:5-11 a.go:4:5-11 a.go:6:36-42"},
+		{srcpos.Rune, 6, 32, "a.go:4:5-7 a.go:4:5-7 a.go:6:32-34"},
+		{srcpos.UTF16, 6, 33, "a.go:4:5-7 a.go:4:5-7 a.go:6:32-34"},
+	} {
+		c := newSourceCheck(t, map[string]string{"a.go": posEncodingSource})
+		c.w.PosEncoding = test.enc
+		c.check(t, fmt.Sprintf("a.go:%d:%d", test.line, test.column), &FindMode{Define: true, Usage: true, End: true})
+		out, _ := c.lookup()
+		c.remove()
+		if got := strings.Join(strings.Fields(out), " "); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.enc, got, test.want)
+		}
+	}
+}
+
+var genericsSource = `package gn
+
+type Number interface {
+	~int | ~float64
+}
+
+type List[T any] struct {
+	items []T
+}
+
+func (l *List[T]) Push(v T) {
+	l.items = append(l.items, v)
+}
+
+func Sum[N Number](list []N) (n N) {
+	for _, v := range list {
+		n += v
+	}
+	return
+}
+
+func use() {
+	var a List[int]
+	a.Push(1)
+	var b List[string]
+	b.Push("x")
+	_ = Sum([]float64{1, 2})
+}
+`
+
+func TestGenerics(t *testing.T) {
+	if !enableTypeParams {
+		t.Skip("type parameters not supported")
+	}
+	files := map[string]string{"gn.go": genericsSource}
+	for _, test := range []struct {
+		pos  string
+		mode *FindMode
+		want string
+	}{
+		{"gn.go:Sum([]float64", &FindMode{Info: true}, "func Sum[N Number](list []N) (n N)\nfunc Sum[N float64](list []float64) (n float64)\n"},
+		{"gn.go:List[int]", &FindMode{Info: true}, "type List[T any] struct{items []T}\ntype List[T int] struct{items []int}\n"},
+		{`gn.go:Push("x")`, &FindMode{Info: true}, "func (*List[string]).Push(v string)\n"},
+		{`gn.go:Push("x")`, &FindMode{Usage: true}, "gn.go:11:19\ngn.go:24:4\ngn.go:26:4\n"},
+	} {
+		c := checkSource(t, files, test.pos, test.mode)
+		got, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+
+	c := checkSource(t, files, "", nil)
+	defer c.remove()
+	want := map[string]ObjKind{"Number": ObjConstraint, "List": ObjStruct, "T": ObjTypeParam, "N": ObjTypeParam}
+	for id, obj := range c.conf.Info.Defs {
+		if k, ok := want[id.Name]; ok {
+			if kind, _ := parserObjKind(obj); kind != k {
+				t.Errorf("%s: got kind %v, want %v", id.Name, kind, k)
+			}
+		}
+	}
+}
+
+var unusedSource = `package main
+
+import "fmt"
+
+type T struct{ n int }
+
+func (t *T) String() string { return fmt.Sprint(t.n) }
+
+func (t *T) loop() { t.loop() }
+
+type lonely int
+
+func helper() *T { return &T{} }
+
+func dead() {}
+
+//export exported
+func exported() {}
+
+func main() { fmt.Println(helper()) }
+`
+
+func TestUnused(t *testing.T) {
+	c := checkSource(t, map[string]string{"main.go": unusedSource}, "", &FindMode{Doc: true})
+	defer c.remove()
+	var got []string
+	for _, d := range c.w.Unused([]*PkgConfig{c.conf}, nil, false, true) {
+		got = append(got, fmt.Sprintf("%v:%v %v", d.Line, d.Kind, d.Name))
+	}
+	want := []string{"9:method T.loop", "11:type lonely", "15:func dead"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var semTokensSource = `package main
+
+import "io/ioutil"
+
+// Deprecated: use Max.
+const Limit = 10
+
+func read(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+`
+
+func TestSemanticTokens(t *testing.T) {
+	c := checkSource(t, map[string]string{"main.go": semTokensSource}, "main.go", nil)
+	defer c.remove()
+	list, err := c.w.LookupSemanticTokens(c.conf, c.cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range list {
+		got = append(got, strings.TrimSpace(fmt.Sprintf("%v:%v:%v %v %v", tok.Line, tok.Column, tok.Length, tok.Type, strings.Join(tok.Modifiers, ","))))
+	}
+	want := []string{
+		"1:9:4 namespace definition",
+		"6:7:5 variable definition,readonly,deprecated",
+		"8:6:4 function definition",
+		"8:11:4 parameter definition",
+		"8:16:6 type defaultLibrary",
+		"8:27:4 type defaultLibrary",
+		"8:33:5 interface defaultLibrary",
+		"9:9:6 namespace defaultLibrary",
+		"9:16:8 function deprecated,defaultLibrary",
+		"9:25:4 parameter",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+var methodSetSource = `package ms
+
+import "bufio"
+
+type Base struct{ *bufio.Reader }
+
+func (Base) Name() string { return "" }
+
+type T struct {
+	Base
+}
+
+func (t *T) Close() error { return nil }
+
+type Named interface{ Name() string }
+
+type NamedCloser interface {
+	Named
+	Close() error
+}
+`
+
+func TestMethodSet(t *testing.T) {
+	for _, test := range []struct{ pos, want string }{
+		{"ms.go:T struct", `methodset T
+	Name() string promoted via Base ms.go:7:13
+methodset *T
+	Close() error declared ms.go:13:13
+	Name() string promoted via Base ms.go:7:13
+embedded T
+	Base ms.go:5:6
+`},
+		{"ms.go:NamedCloser interface", `methodset NamedCloser
+	Close() error declared ms.go:19:2
+	Name() string promoted via Named ms.go:15:23
+embedded NamedCloser
+	Named ms.go:15:6
+`},
+	} {
+		c := checkSource(t, map[string]string{"ms.go": methodSetSource}, test.pos, &FindMode{MethodSet: true})
+		out, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, line := range strings.Split(out, "\n") {
+			if !strings.Contains(line, "bufio.Reader") || strings.Contains(line, "Close") {
+				lines = append(lines, line)
+			}
+		}
+		if got := strings.Join(lines, "\n"); got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
+
+var typeDefSource = `package td
+
+type Func func(int) error
+
+type MyFunc Func
+
+var m map[string][]*MyFunc
+`
+
+func TestTypeDef(t *testing.T) {
+	for _, test := range []struct {
+		pos  string
+		mode *FindMode
+		want string
+	}{
+		{"td.go:m map", &FindMode{TypeDef: true, Explain: true}, "td.go:5:6\nmap[string][]*MyFunc\n"},
+		{"td.go:MyFunc Func", &FindMode{Explain: true}, "MyFunc -> Func -> func(int) error\n"},
+	} {
+		c := checkSource(t, map[string]string{"td.go": typeDefSource}, test.pos, test.mode)
+		got, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
+
+var highlightSource = `package hl
+
+type T struct{ N int }
+
+func f(t T) int {
+	x := t.N
+	x += 2
+	x++
+	p := &x
+	t = T{N: *p}
+	return x
+}
+`
+
+func TestHighlight(t *testing.T) {
+	for _, test := range []struct{ pos, want string }{
+		{"hl.go:x :=", `hl.go:6:2-3 definition
+hl.go:7:2-3 write
+hl.go:8:2-3 write
+hl.go:9:8-9 write
+hl.go:11:9-10 read
+`},
+		{"hl.go:N int", `hl.go:3:16-17 definition
+hl.go:6:9-10 read
+hl.go:10:8-9 write
+`},
+	} {
+		c := checkSource(t, map[string]string{"hl.go": highlightSource}, test.pos, &FindMode{Highlight: true})
+		got, err := c.lookup()
+		c.remove()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got\n%s\nwant\n%s", test.pos, got, test.want)
+		}
+	}
+}
+
+var usageContextSource = `package uc
+
+type Server struct{}
+
+func (s *Server) handle() { helper() }
+
+func helper() {}
+
+var h = helper
+`
+
+func TestUsageContext(t *testing.T) {
+	c := checkSource(t, map[string]string{"uc.go": usageContextSource}, "uc.go:helper() {}", &FindMode{Usage: true, Context: true})
+	defer c.remove()
+	want := `package ` + c.pkg.Path() + `
+uc.go:5:29: (*Server).handle: func (s *Server) handle() { helper() }
+uc.go:7:6: helper: func helper() {}
+uc.go:9:9: h: var h = helper
+`
+	got, err := c.lookup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+var hintsSource = `package hi
+
+const (
+	A = iota * 2
+	B
+)
+
+func sum(base int, xs ...int) int { return base }
+
+func f() {
+	x := sum(1, 2, 3)
+	for i := range []string{} {
+		_ = i
+	}
+	_ = sum(x)
+}
+`
+
+func TestInlayHints(t *testing.T) {
+	c := checkSource(t, map[string]string{"hi.go": hintsSource}, "hi.go", nil)
+	defer c.remove()
+	for _, test := range []struct {
+		from, to int
+		want     string
+	}{
+		{0, 0, `4:3 value = 0
+5:3 value = 2
+11:3 type int
+11:11 parameter base:
+11:14 parameter xs...:
+12:7 type int`},
+		{11, 11, `11:3 type int
+11:11 parameter base:
+11:14 parameter xs...:`},
+	} {
+		list, err := c.w.LookupInlayHints(c.conf, c.cursor, test.from, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, h := range list {
+			lines = append(lines, fmt.Sprintf("%d:%d %s %s", h.Line, h.Column, h.Kind, h.Label))
+		}
+		if got := strings.Join(lines, "\n"); got != test.want {
+			t.Fatalf("%v-%v: got\n%s\nwant\n%s", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+var stubSource = `package im
+
+import "io"
+
+type T struct{}
+
+func (t *T) Close() error { return nil }
+
+type Closer interface {
+	io.Closer
+	// Load loads r.
+	Load(r io.Reader, n int) error
+}
+`
+
+func TestImplementStubs(t *testing.T) {
+	c := checkSource(t, map[string]string{"im.go": stubSource}, "im.go:T struct", &FindMode{Doc: true})
+	defer c.remove()
+	for _, test := range []struct {
+		cursor bool
+		typ    string
+		iface  string
+		want   string // type and methods
+		code   string
+		offset int
+	}{
+		{true, "", "Closer", "*T Load", `// Load loads r.
+func (t *T) Load(r io.Reader, n int) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`, strings.Index(stubSource, "\n\nfunc (t *T)")},
+		// Close of *T is not in the method set of T, so T gets no second Close
+		{false, "T", "io.ReadWriteCloser", "*T Read Write", "", -1},
+	} {
+		cursor := c.cursor
+		if !test.cursor {
+			cursor = nil
+		}
+		stubs, err := c.w.ImplementStubs(c.conf, cursor, test.typ, test.iface)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stubs.Type + " " + strings.Join(stubs.Methods, " "); got != test.want || len(stubs.Imports) != 0 {
+			t.Fatalf("%v: got %v %v, want %v", test.iface, got, stubs.Imports, test.want)
+		}
+		if test.code != "" && stubs.Code != test.code {
+			t.Fatalf("%v: got\n%s\nwant\n%s", test.iface, stubs.Code, test.code)
+		}
+		if test.offset >= 0 && stubs.Offset != test.offset {
+			t.Fatalf("%v: got offset %v, want %v", test.iface, stubs.Offset, test.offset)
+		}
+	}
+}
+
+var mockSource = `package mk
+
+import "io"
+
+type Store interface {
+	io.Closer
+	Put(key string, vals ...int) error
+	Get(_ string, fn int) bool
+}
+`
+
+func TestGenerateMock(t *testing.T) {
+	c := checkSource(t, map[string]string{"mk.go": mockSource}, "", nil)
+	defer c.remove()
+	for _, test := range []struct {
+		name, pkg string
+		want      []string
+	}{
+		{"", "", []string{
+			"package mk\n",
+			"type MockStore struct {",
+			"\tPutFunc    func(string, ...int) error\n",
+			"type MockStorePutCall struct {\n\tKey  string\n\tVals []int\n}",
+			"func (m *MockStore) Put(key string, vals ...int) error {",
+			"m.callsPut = append(m.callsPut, MockStorePutCall{Key: key, Vals: vals})",
+			"return fn(key, vals...)",
+			"func (m *MockStore) Get(arg0 string, arg1 int) bool {",
+			"func (m *MockStore) ExpectClose(r0 error) *MockStore {",
+			"func (m *MockStore) CloseCallCount() int {",
+		}},
+		{"Fake", "mk_test", []string{"package mk_test\n", "type Fake struct"}},
+	} {
+		src, err := c.w.GenerateMock(c.conf, c.dir, "Store", test.name, test.pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(src), want) {
+				t.Fatalf("missing %q in\n%s", want, src)
+			}
+		}
+		if again, err := c.w.GenerateMock(c.conf, c.dir, "Store", test.name, test.pkg); err != nil || string(again) != string(src) {
+			t.Fatalf("regenerated mock differs: %v", err)
+		}
+	}
+}
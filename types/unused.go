@@ -0,0 +1,319 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// UnusedDecl is a package level declaration, method or field without uses.
+type UnusedDecl struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"` // Type.Method for methods, Type.Field for fields
+	Package  string `json:"package"`
+}
+
+func (d *UnusedDecl) String() string {
+	pos := token.Position{Filename: d.Filename, Line: d.Line, Column: d.Column}
+	return pos.String() + ": " + d.Kind + " " + d.Name + " is unused"
+}
+
+// unusedUnit is a checked package, its test package or external test
+// package, and its files. Only the declarations of reported units are
+// reported.
+type unusedUnit struct {
+	pkg      *types.Package
+	info     *types.Info
+	files    []*ast.File
+	reported bool
+}
+
+// Unused returns the declarations of the checked packages confs that are
+// not used by any of them or of the checked packages users, as the other
+// packages of the workspace, sorted by position. Uses inside the declaration
+// itself do not count, so recursive funcs and types used only by their own
+// methods are unused. Not reported are main and init, the test funcs of
+// test files, funcs named by //go:linkname or exported to cgo by //export,
+// methods that implement an interface and embedded fields. Fields are only
+// reported if fields is set, exported declarations only if exported is set.
+// The comments of the files must be parsed for the directives.
+func (w *PkgWalker) Unused(confs []*PkgConfig, users []*PkgConfig, fields bool, exported bool) (list []*UnusedDecl) {
+	var units []*unusedUnit
+	seen := make(map[*PkgConfig]bool)
+	for i, conf := range append(append([]*PkgConfig{}, confs...), users...) {
+		if seen[conf] {
+			continue
+		}
+		seen[conf] = true
+		reported := i < len(confs)
+		if conf.Pkg != nil {
+			units = append(units, &unusedUnit{conf.Pkg, conf.Info, sortedFiles(conf.Files), reported})
+		}
+		if conf.XPkg != nil {
+			units = append(units, &unusedUnit{conf.XPkg, conf.XInfo, sortedFiles(conf.XTestFiles), reported})
+		}
+	}
+
+	// objects of different checks of a package have the same position
+	key := func(obj types.Object) string {
+		return w.FileSet.Position(obj.Pos()).String()
+	}
+	used := make(map[string]bool)
+	linked := make(map[string]bool)
+	for _, u := range units {
+		for _, f := range u.files {
+			var nodes []ast.Node
+			for _, decl := range f.Decls {
+				if d, ok := decl.(*ast.GenDecl); ok {
+					// the specs of a group are declared one by one
+					for _, spec := range d.Specs {
+						nodes = append(nodes, spec)
+					}
+				} else {
+					nodes = append(nodes, decl)
+				}
+			}
+			for _, node := range nodes {
+				owners := declObjects(u.info, node, key)
+				ast.Inspect(node, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok {
+						if obj := u.info.Uses[id]; obj != nil && obj.Pkg() != nil && !owners[key(obj)] {
+							used[key(obj)] = true
+						}
+					}
+					return true
+				})
+			}
+			for _, name := range directiveNames(f) {
+				if strings.Contains(name, ".") {
+					linked[name] = true
+				} else {
+					linked[u.pkg.Path()+"."+name] = true
+				}
+			}
+		}
+	}
+
+	ifaces := interfacesByMethod(units)
+	report := func(u *unusedUnit, obj types.Object, kind ObjKind, name string) {
+		if obj == nil || obj.Name() == "_" || used[key(obj)] {
+			return
+		}
+		if !exported && obj.Exported() && u.pkg.Name() != "main" && !strings.HasSuffix(u.pkg.Path(), "_test") {
+			return
+		}
+		pos := w.position(obj.Pos())
+		list = append(list, &UnusedDecl{Filename: pos.Filename, Line: pos.Line, Column: pos.Column,
+			Kind: kind.String(), Name: name, Package: u.pkg.Path()})
+	}
+	for _, u := range units {
+		if !u.reported {
+			continue
+		}
+		for _, f := range u.files {
+			filename := w.FileSet.Position(f.Pos()).Filename
+			isTest := strings.HasSuffix(filename, "_test.go")
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					obj, ok := u.info.Defs[d.Name].(*types.Func)
+					if !ok {
+						continue
+					}
+					name := obj.Name()
+					if d.Recv == nil {
+						if name == "init" || (name == "main" && u.pkg.Name() == "main") ||
+							(isTest && isTestFunc(name)) || linked[u.pkg.Path()+"."+name] {
+							continue
+						}
+						report(u, obj, ObjFunc, name)
+						continue
+					}
+					named, _ := parseNamed(obj.Type().(*types.Signature).Recv().Type())
+					if named == nil || implementsMethod(named, obj, ifaces) {
+						continue
+					}
+					report(u, obj, ObjMethod, named.Obj().Name()+"."+name)
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						switch s := spec.(type) {
+						case *ast.TypeSpec:
+							obj := u.info.Defs[s.Name]
+							if obj == nil {
+								continue
+							}
+							kind, _ := parserObjKind(obj)
+							report(u, obj, kind, obj.Name())
+							st, ok := s.Type.(*ast.StructType)
+							if !fields || !ok {
+								continue
+							}
+							for _, field := range st.Fields.List {
+								for _, id := range field.Names {
+									report(u, u.info.Defs[id], ObjField, obj.Name()+"."+id.Name)
+								}
+							}
+						case *ast.ValueSpec:
+							for _, id := range s.Names {
+								obj := u.info.Defs[id]
+								if obj == nil || linked[u.pkg.Path()+"."+id.Name] {
+									continue
+								}
+								kind, _ := parserObjKind(obj)
+								report(u, obj, kind, id.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return
+}
+
+func sortedFiles(files map[string]*ast.File) (list []*ast.File) {
+	var names []string
+	for name, f := range files {
+		if f != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, files[name])
+	}
+	return
+}
+
+// declObjects returns the keys of the objects a use inside the func decl or
+// the spec node does not count for: the objects it declares and the
+// receiver base type of a method.
+func declObjects(info *types.Info, node ast.Node, key func(obj types.Object) string) map[string]bool {
+	owners := make(map[string]bool)
+	add := func(id *ast.Ident) {
+		if obj := info.Defs[id]; obj != nil {
+			owners[key(obj)] = true
+		}
+	}
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		add(n.Name)
+		if obj, ok := info.Defs[n.Name].(*types.Func); ok && n.Recv != nil {
+			if named, _ := parseNamed(obj.Type().(*types.Signature).Recv().Type()); named != nil {
+				owners[key(named.Obj())] = true
+			}
+		}
+	case *ast.TypeSpec:
+		add(n.Name)
+	case *ast.ValueSpec:
+		for _, id := range n.Names {
+			add(id)
+		}
+	}
+	return owners
+}
+
+func isTestFunc(name string) bool {
+	for _, prefix := range []string{"Test", "Benchmark", "Example", "Fuzz"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// directiveNames returns the local names of the //go:linkname directives of
+// f, and their targets importpath.name, and the names of the cgo //export
+// directives.
+func directiveNames(f *ast.File) (names []string) {
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			fields := strings.Fields(c.Text)
+			switch {
+			case len(fields) >= 2 && fields[0] == "//go:linkname":
+				names = append(names, fields[1:]...)
+			case len(fields) == 2 && fields[0] == "//export":
+				names = append(names, fields[1])
+			}
+		}
+	}
+	return
+}
+
+// interfacesByMethod returns the interfaces with methods used by the units
+// and declared by them and the packages they import, and the error
+// interface, by the names of their methods.
+func interfacesByMethod(units []*unusedUnit) map[string][]*types.Interface {
+	byName := make(map[string][]*types.Interface)
+	seen := make(map[*types.Interface]bool)
+	add := func(typ types.Type) {
+		iface, ok := typ.Underlying().(*types.Interface)
+		if !ok || iface.NumMethods() == 0 || seen[iface] {
+			return
+		}
+		seen[iface] = true
+		for i := 0; i < iface.NumMethods(); i++ {
+			name := iface.Method(i).Name()
+			byName[name] = append(byName[name], iface)
+		}
+	}
+	add(types.Universe.Lookup("error").Type())
+	pkgs := make(map[*types.Package]bool)
+	var addPkg func(pkg *types.Package)
+	addPkg = func(pkg *types.Package) {
+		if pkg == nil || pkgs[pkg] {
+			return
+		}
+		pkgs[pkg] = true
+		for _, t := range scopeTypeNames([]*types.Package{pkg}) {
+			add(t.Type())
+		}
+		for _, im := range pkg.Imports() {
+			addPkg(im)
+		}
+	}
+	for _, u := range units {
+		addPkg(u.pkg)
+		for _, tv := range u.info.Types {
+			if tv.Type != nil {
+				add(tv.Type)
+			}
+		}
+	}
+	return byName
+}
+
+// implementsMethod reports whether the method of named implements a method
+// of one of the interfaces. For generic types only the names are matched.
+func implementsMethod(named *types.Named, method *types.Func, ifaces map[string][]*types.Interface) bool {
+	list := ifaces[method.Name()]
+	if len(list) > 0 && isGenericType(named) {
+		return true
+	}
+	ptr := types.NewPointer(named)
+	for _, iface := range list {
+		if implements(named, iface) || implements(ptr, iface) {
+			return true
+		}
+	}
+	return false
+}
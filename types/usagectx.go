@@ -0,0 +1,127 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// usageContext is a usage with its package, the name of the enclosing
+// declaration and the text of its line.
+type usageContext struct {
+	pos       token.Pos
+	pkg       string
+	enclosing string
+	line      string
+	test      bool
+}
+
+// printUsageContexts prints the usages of the package conf grouped by
+// package, each group after a package result, with the enclosing
+// declaration, as (*Server).handle, and the line text of each usage.
+func (w *PkgWalker) printUsageContexts(conf *PkgConfig, usages []int) {
+	var list []*usageContext
+	for _, pos := range usages {
+		list = append(list, w.usageContext(conf, token.Pos(pos)))
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].pkg != list[j].pkg {
+			return list[i].pkg < list[j].pkg
+		}
+		return list[i].pos < list[j].pos
+	})
+	var last *usageContext
+	for _, u := range list {
+		if last != nil && u.pos == last.pos {
+			continue
+		}
+		if last == nil || u.pkg != last.pkg {
+			w.cmd.PrintResult(&Result{Kind: "package", Path: u.pkg}, "package "+u.pkg)
+		}
+		last = u
+		r := w.posResult("usage", u.pos)
+		r.Path, r.Name, r.Text, r.Test = u.pkg, u.enclosing, u.line, u.test
+		text := w.posText(w.positionRange(u.pos))
+		if u.enclosing != "" {
+			text += ": " + u.enclosing
+		}
+		w.cmd.PrintResult(r, text+": "+strings.TrimSpace(u.line))
+	}
+}
+
+func (w *PkgWalker) usageContext(conf *PkgConfig, pos token.Pos) *usageContext {
+	p := w.FileSet.Position(pos)
+	u := &usageContext{pos: pos, test: strings.HasSuffix(p.Filename, "_test.go")}
+	if conf != nil {
+		if conf.Pkg != nil {
+			u.pkg = conf.Pkg.Path()
+		}
+		name := filepath.Base(p.Filename)
+		if _, ok := conf.XTestFiles[name]; ok && conf.XPkg != nil && (conf.Bpkg == nil || filepath.Dir(p.Filename) == conf.Bpkg.Dir) {
+			u.pkg = conf.XPkg.Path()
+		}
+	}
+	if f := w.ParsedFileCache[p.Filename]; f != nil && pos >= f.Pos() && pos <= f.End() {
+		u.enclosing = enclosingDeclName(f, pos)
+	}
+	if src, err := w.fileData(p.Filename); err == nil && p.Offset <= len(src) {
+		start := bytes.LastIndexByte(src[:p.Offset], '\n') + 1
+		end := bytes.IndexByte(src[p.Offset:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += p.Offset
+		}
+		u.line = strings.TrimRight(string(src[start:end]), "\r")
+	}
+	return u
+}
+
+// enclosingDeclName returns the name of the func, method, type, var or
+// const declaration of f enclosing pos. Methods are named as (*T).Method
+// or T.Method.
+func enclosingDeclName(f *ast.File, pos token.Pos) string {
+	for _, decl := range f.Decls {
+		if pos < decl.Pos() || pos > decl.End() {
+			continue
+		}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				return d.Name.Name
+			}
+			typ := d.Recv.List[0].Type
+			if p, ok := typ.(*ast.ParenExpr); ok {
+				typ = p.X
+			}
+			if star, ok := typ.(*ast.StarExpr); ok {
+				return "(*" + recvBaseName(star.X) + ")." + d.Name.Name
+			}
+			return recvBaseName(typ) + "." + d.Name.Name
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if pos < spec.Pos() || pos > spec.End() {
+					continue
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					return s.Name.Name
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						if id.Name != "_" {
+							return id.Name
+						}
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+// Copyright 2011-2023 visualfc <visualfc@gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unused
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/gotools/pkg/buildctx"
+	"github.com/visualfc/gotools/pkg/command"
+	"github.com/visualfc/gotools/pkg/gomod"
+	"github.com/visualfc/gotools/pkg/pkgutil"
+	"github.com/visualfc/gotools/pkg/srcpos"
+	"github.com/visualfc/gotools/types"
+)
+
+var Command = &command.Command{
+	Run:       runUnused,
+	UsageLine: "unused [-tags tags] [-test=false] [-exported=false] [-fields] [pkgs...]",
+	Short:     "find unused declarations",
+	Long: `Unused type-checks the packages, by default all packages of the main
+modules of the current directory or the packages below it outside of
+modules, and prints their declarations without uses as
+file:line:column: kind name is unused.
+
+Unexported declarations are reported if their package does not use them,
+exported ones if no package of the main modules uses them, or outside of
+modules none of the packages. Uses inside the declaration itself do not
+count. The funcs main and init, test funcs, funcs named by //go:linkname or
+exported to cgo by //export and methods implementing an interface are never
+reported. The uses of test files count and their declarations are reported
+too unless -test=false. Exported declarations are not reported with
+-exported=false, struct fields only with -fields.
+
+The packages are directories, import paths or patterns ending in /... .`,
+}
+
+var (
+	unusedTags     string
+	unusedTest     bool
+	unusedExported bool
+	unusedFields   bool
+	unusedPosEnc   string
+)
+
+func init() {
+	Command.Flag.StringVar(&unusedTags, "tags", "", "space-separated list of build tags to apply when parsing")
+	Command.Flag.BoolVar(&unusedTest, "test", true, "check test files")
+	Command.Flag.BoolVar(&unusedExported, "exported", true, "report exported declarations")
+	Command.Flag.BoolVar(&unusedFields, "fields", false, "report struct fields")
+	Command.Flag.StringVar(&unusedPosEnc, "posenc", "byte", "encoding of columns: byte, rune or utf16")
+}
+
+func runUnused(cmd *command.Command, args []string) error {
+	enc, err := srcpos.ParseEncoding(unusedPosEnc)
+	if err != nil {
+		return err
+	}
+	context := buildctx.System()
+	if unusedTags != "" {
+		context.BuildTags = append(strings.Split(unusedTags, " "), context.BuildTags...)
+	}
+	dir, _ := os.Getwd()
+	ws, _ := gomod.LoadWorkspace(dir, context)
+	if len(args) == 0 {
+		args = []string{"./..."}
+		if ws != nil {
+			args = nil
+			for _, m := range ws.MainModules() {
+				args = append(args, filepath.Join(m.Dir, "..."))
+			}
+		}
+	}
+	pkgs, err := expandPatterns(args)
+	if err != nil {
+		return err
+	}
+	// the uses of all packages of the main modules count
+	var users []string
+	if ws != nil {
+		var roots []string
+		for _, m := range ws.MainModules() {
+			roots = append(roots, filepath.Join(m.Dir, "..."))
+		}
+		if users, err = expandPatterns(roots); err != nil {
+			return err
+		}
+	}
+
+	w := types.NewPkgWalker(context)
+	w.SetOutput(cmd.Stdout, cmd.Stderr)
+	w.SetFindMode(&types.FindMode{Doc: true})
+	w.PosEncoding = enc
+	// uses are matched by position, export data has no columns
+	w.ExportCache = nil
+	var confs, userConfs []*types.PkgConfig
+	selected := make(map[string]bool)
+	for _, pkg := range pkgs {
+		selected[pkg] = true
+		_, conf, err := w.Check(pkg, types.NewPkgConfig(false, unusedTest), nil)
+		if conf == nil {
+			if _, ok := err.(*build.NoGoError); !ok && err != nil {
+				fmt.Fprintf(cmd.Stderr, "%v: %v\n", pkg, err)
+			}
+			continue
+		}
+		confs = append(confs, conf)
+	}
+	for _, pkg := range users {
+		if selected[pkg] {
+			continue
+		}
+		if _, conf, _ := w.Check(pkg, types.NewPkgConfig(false, unusedTest), nil); conf != nil {
+			userConfs = append(userConfs, conf)
+		}
+	}
+	for _, d := range w.Unused(confs, userConfs, unusedFields, unusedExported) {
+		cmd.PrintResult(d, d.String())
+	}
+	return nil
+}
+
+func expandPatterns(args []string) (pkgs []string, err error) {
+	for _, arg := range args {
+		list, err := pkgutil.ExpandPattern(arg)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, list...)
+	}
+	return pkgs, nil
+}